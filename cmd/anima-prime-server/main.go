@@ -0,0 +1,127 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Standalone server for the Anima Prime API. Unlike the App Engine entrypoint in the repository root,
+// it keeps its data in memory or in a bolt file so it can be deployed on any Linux box or container.
+// The App Engine packages are still linked in through models but never called
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dorklord23/anima-prime/dice"
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/routes"
+	"github.com/dorklord23/anima-prime/utils"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	tlsCert := flag.String("tls-cert", "", "path to the TLS certificate. Serves plain HTTP when empty")
+	tlsKey := flag.String("tls-key", "", "path to the TLS private key")
+	storage := flag.String("storage", "memory", "storage backend to use: memory or bolt")
+	dbPath := flag.String("db", "anima-prime.db", "path to the database file used by the bolt backend")
+	readTimeout := flag.Duration("read-timeout", 15*time.Second, "maximum duration for reading a whole request")
+	writeTimeout := flag.Duration("write-timeout", 15*time.Second, "maximum duration before timing out writes of a response")
+	idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "maximum time to wait for the next request on a keep-alive connection")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for in-flight requests on shutdown")
+	ephemeralTokenKey := flag.Bool("ephemeral-token-key", false, "sign access tokens with a random key when ANIMA_PRIME_TOKEN_KEYS is empty, for local development. Tokens don't survive a restart")
+	diceSeed := flag.Uint64("dice-seed", 0, "roll a reproducible sequence of dice out of this seed, for tests and replays. Rolls unpredictably when 0")
+	flag.Parse()
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("Both -tls-cert and -tls-key must be supplied to serve HTTPS")
+	}
+
+	// Datastore needs the App Engine runtime
+	if *storage != "memory" && *storage != "bolt" {
+		log.Fatalf("Unknown storage backend %q, use memory or bolt", *storage)
+	}
+
+	if *diceSeed != 0 {
+		log.Print("Rolling seeded dice, players could predict them")
+		dice.Default = dice.New(dice.Seeded(*diceSeed))
+	}
+
+	// Keys used to sign access tokens. Read from the environment to keep secrets out of the process list
+	tokenKeys := os.Getenv("ANIMA_PRIME_TOKEN_KEYS")
+	if tokenKeys == "" && *ephemeralTokenKey {
+		log.Print("Signing access tokens with a random key, they won't survive a restart")
+		if err := utils.GenerateSigningKey(); err != nil {
+			log.Fatal(err)
+		}
+	} else if err := utils.LoadSigningKeys(tokenKeys); err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := models.NewStorage(*storage, *dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	models.Store = store
+
+	server := &http.Server{
+		Addr:         *addr,
+		Handler:      routes.NewRouter(),
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+
+	err2 := serve(server, *tlsCert, *tlsKey, *shutdownTimeout)
+
+	// File-backed storage must be released so the next start can acquire the lock, which log.Fatal would skip
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if err2 != nil {
+		log.Fatal(err2)
+	}
+}
+
+// serve : listen until the server fails or SIGINT/SIGTERM asks it to stop accepting new connections,
+// then let the in-flight requests finish
+func serve(server *http.Server, tlsCert string, tlsKey string, shutdownTimeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %v", server.Addr)
+		if tlsCert != "" {
+			serverErr <- server.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		log.Print("Shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		return server.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,94 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package dice rolls six-sided dice out of an injectable source of randomness.
+// Rolls are unpredictable by default and reproducible when seeded, e.g. to replay them or to test what depends on them
+package dice
+
+import (
+	"crypto/rand"
+	"math/big"
+	mathrand "math/rand/v2"
+	"sync"
+)
+
+// Sides : how many sides a die has
+const Sides = 6
+
+// Source : where the randomness of the dice comes from
+type Source interface {
+	// IntN : a uniformly distributed number in [0, n)
+	IntN(n int) int
+}
+
+// Roller : rolls dice out of a source of randomness
+type Roller struct {
+	source Source
+}
+
+// Default : the roller the API rolls with. Unpredictable unless the server is started with a seed
+var Default = New(Crypto())
+
+// New : function to create a roller out of a source of randomness
+func New(source Source) *Roller {
+	return &Roller{source: source}
+}
+
+// Die : roll a single die, from 1 to 6
+func (r *Roller) Die() int {
+	return r.source.IntN(Sides) + 1
+}
+
+// Roll : roll arbitrary number of dice. No die is rolled for a negative quantity
+func (r *Roller) Roll(dieQty int) []int {
+	if dieQty < 0 {
+		dieQty = 0
+	}
+
+	result := make([]int, dieQty)
+	for i := range result {
+		result[i] = r.Die()
+	}
+
+	return result
+}
+
+// cryptoSource : randomness from the operating system, which players can't predict
+type cryptoSource struct{}
+
+// Crypto : the source of unpredictable randomness used by default
+func Crypto() Source {
+	return cryptoSource{}
+}
+
+// IntN : crypto/rand picks without modulo bias. The operating system failing to provide randomness is unrecoverable
+func (cryptoSource) IntN(n int) int {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err)
+	}
+
+	return int(value.Int64())
+}
+
+// seededSource : a deterministic sequence that is safe to share between requests
+type seededSource struct {
+	mutex sync.Mutex
+	rng   *mathrand.Rand
+}
+
+// Seeded : a source giving the same sequence for the same seed. Players could predict it so only use it for tests and replays
+func Seeded(seed uint64) Source {
+	return &seededSource{rng: mathrand.New(mathrand.NewPCG(seed, seed))}
+}
+
+// IntN : the next number of the sequence
+func (s *seededSource) IntN(n int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rng.IntN(n)
+}
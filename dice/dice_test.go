@@ -0,0 +1,126 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package dice
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// rollCount : how many dice the statistical tests roll
+const rollCount = 60000
+
+// chiSquareLimit : the chi-square value a fair die stays under 99.9% of the time, with 5 degrees of freedom
+const chiSquareLimit = 20.515
+
+// sources : every source the dice could be rolled out of
+func sources() map[string]Source {
+	return map[string]Source{
+		"crypto": Crypto(),
+		"seeded": Seeded(42),
+		"fair":   Fair(bytes.Repeat([]byte{7}, SeedSize), "client seed"),
+	}
+}
+
+func TestRollStaysWithinSides(t *testing.T) {
+	for name, source := range sources() {
+		for _, value := range New(source).Roll(rollCount) {
+			if value < 1 || value > Sides {
+				t.Fatalf("%v: rolled %v, want 1 to %v", name, value, Sides)
+			}
+		}
+	}
+}
+
+func TestRollIsUniform(t *testing.T) {
+	for name, source := range sources() {
+		counts := make([]int, Sides)
+		for _, value := range New(source).Roll(rollCount) {
+			counts[value-1]++
+		}
+
+		expected := float64(rollCount) / Sides
+		chiSquare := 0.0
+		for _, count := range counts {
+			chiSquare += (float64(count) - expected) * (float64(count) - expected) / expected
+		}
+
+		if chiSquare > chiSquareLimit {
+			t.Errorf("%v: chi-square of %.2f over %v, counts %v", name, chiSquare, chiSquareLimit, counts)
+		}
+	}
+}
+
+func TestRollNegativeQuantity(t *testing.T) {
+	if dice := New(Crypto()).Roll(-1); len(dice) != 0 {
+		t.Errorf("rolled %v, want no die", dice)
+	}
+}
+
+func TestSeededReproducesRolls(t *testing.T) {
+	first := New(Seeded(7)).Roll(100)
+	second := New(Seeded(7)).Roll(100)
+	if !slices.Equal(first, second) {
+		t.Errorf("the same seed rolled %v then %v", first, second)
+	}
+
+	other := New(Seeded(8)).Roll(100)
+	if slices.Equal(first, other) {
+		t.Errorf("different seeds rolled the same %v", first)
+	}
+}
+
+func TestCommitHashesSeed(t *testing.T) {
+	seed, err := NewServerSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seed) != SeedSize {
+		t.Fatalf("seed of %v bytes, want %v", len(seed), SeedSize)
+	}
+
+	hash := sha256.Sum256(seed)
+	if got, want := Commit(seed), hex.EncodeToString(hash[:]); got != want {
+		t.Errorf("Commit = %v, want %v", got, want)
+	}
+}
+
+// TestFairRecomputes : recompute the dice of a revealed roll the way the README tells players to
+func TestFairRecomputes(t *testing.T) {
+	seed, err := NewServerSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSeed := "any text"
+
+	// Enough dice to go through several blocks of the stream
+	rolled := New(Fair(seed, clientSeed)).Roll(100)
+
+	var recomputed []int
+	for block := 0; len(recomputed) < len(rolled); block++ {
+		mac := hmac.New(sha256.New, seed)
+		mac.Write([]byte(fmt.Sprintf("%v:%v", clientSeed, block)))
+		for _, b := range mac.Sum(nil) {
+			if b < 252 && len(recomputed) < len(rolled) {
+				recomputed = append(recomputed, int(b)%6+1)
+			}
+		}
+	}
+
+	if !slices.Equal(rolled, recomputed) {
+		t.Errorf("rolled %v, recomputed %v", rolled, recomputed)
+	}
+
+	if other := New(Fair(seed, "other text")).Roll(100); slices.Equal(rolled, other) {
+		t.Errorf("different client seeds rolled the same %v", rolled)
+	}
+}
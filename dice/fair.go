@@ -0,0 +1,73 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package dice
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// SeedSize : how many bytes a server seed has
+const SeedSize = 32
+
+// NewServerSeed : a fresh secret seed the server commits to before a roll
+func NewServerSeed() ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	return seed, nil
+}
+
+// Commit : the hash of a server seed, published before the roll so the server can't change the seed afterwards
+func Commit(serverSeed []byte) string {
+	hash := sha256.Sum256(serverSeed)
+	return hex.EncodeToString(hash[:])
+}
+
+// fairSource : a stream of bytes only known once both the server seed and the client seed are.
+// Block i of the stream is HMAC-SHA256(serverSeed, clientSeed + ":" + i) so anyone could recompute it in any language
+type fairSource struct {
+	serverSeed []byte
+	clientSeed string
+	block      int
+	buffer     []byte
+}
+
+// Fair : the source of a commit-reveal roll. The client seed keeps the server from picking a seed that favors it.
+// Unlike the other sources it isn't safe to share between requests
+func Fair(serverSeed []byte, clientSeed string) Source {
+	return &fairSource{serverSeed: serverSeed, clientSeed: clientSeed}
+}
+
+// IntN : the next byte of the stream below the largest multiple of n, modulo n, so every number is as likely.
+// Only supports n up to 256, plenty for dice
+func (s *fairSource) IntN(n int) int {
+	if n <= 0 || n > 256 {
+		panic(fmt.Sprintf("dice: fair source can't pick among %v numbers", n))
+	}
+
+	limit := 256 - 256%n
+	for {
+		if len(s.buffer) == 0 {
+			mac := hmac.New(sha256.New, s.serverSeed)
+			fmt.Fprintf(mac, "%v:%v", s.clientSeed, s.block)
+			s.buffer = mac.Sum(nil)
+			s.block++
+		}
+
+		b := int(s.buffer[0])
+		s.buffer = s.buffer[1:]
+		if b < limit {
+			return b % n
+		}
+	}
+}
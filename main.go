@@ -15,52 +15,42 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 
-	"github.com/dorklord23/anima-prime/middlewares"
+	"github.com/dorklord23/anima-prime/dice"
+	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/routes"
-	"github.com/gorilla/mux"
+	"github.com/dorklord23/anima-prime/utils"
 	"google.golang.org/appengine"
 )
 
 func init() {
-	// A little hack to use mux in App Engine
-	r := mux.NewRouter()
-	s := r.PathPrefix("/api").Subrouter()
+	// Pick the storage backend. Defaults to Google Datastore
+	store, err := models.NewStorage(os.Getenv("ANIMA_PRIME_STORAGE"), os.Getenv("ANIMA_PRIME_DB"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	models.Store = store
+
+	// Dice are unpredictable unless a seed is given, for tests and replays
+	if seed := os.Getenv("ANIMA_PRIME_DICE_SEED"); seed != "" {
+		value, err := strconv.ParseUint(seed, 10, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dice.Default = dice.New(dice.Seeded(value))
+	}
+
+	// Keys used to sign access tokens. See utils.LoadSigningKeys for the format
+	if err := utils.LoadSigningKeys(os.Getenv("ANIMA_PRIME_TOKEN_KEYS")); err != nil {
+		log.Fatal(err)
+	}
 
-	// The only non-RESTful endpoint in this API to accomodate login
-	s.HandleFunc("/login", routes.AuthenticateUser).Methods("POST")
-
-	s.HandleFunc("/users", routes.CreateUsers).Methods("POST")
-	s.HandleFunc("/users/{userKey}", routes.UpdateUsers).Methods("PUT")
-	s.HandleFunc("/users/{userKey}", routes.GetUsers).Methods("GET")
-
-	s.HandleFunc("/characters", routes.CreateCharacters).Methods("POST")
-	s.HandleFunc("/characters/{characterKey}", routes.UpdateCharacters).Methods("PUT")
-	s.HandleFunc("/characters/{characterKey}", routes.GetCharacters).Methods("GET")
-	s.HandleFunc("/characters/{characterKey}", routes.DeleteCharacters).Methods("DELETE")
-
-	s.HandleFunc("/scenes", routes.CreateScenes).Methods("POST")
-	s.HandleFunc("/scenes/{sceneKey}", routes.UpdateScenes).Methods("PUT")
-
-	s.HandleFunc("/conflicts", routes.CreateConflicts).Methods("POST")
-	s.HandleFunc("/conflicts/{conflictKey}", routes.UpdateConflicts).Methods("PUT")
-
-	s.HandleFunc("/powers", routes.CreatePowers).Methods("POST")
-	s.HandleFunc("/powers/{resourceKey}", routes.UpdatePowers).Methods("PUT")
-
-	s.HandleFunc("/eidolons", routes.CreateEidolons).Methods("POST")
-	s.HandleFunc("/eidolons/{resourceKey}", routes.UpdateEidolons).Methods("PUT")
-
-	s.HandleFunc("/characters/{characterKey}/traits/{traitIndex}", routes.ChangeTraitTick).Methods("PUT")
-
-	s.HandleFunc("/rerolls", routes.Reroll).Methods("GET")
-
-	s.HandleFunc("/tokens", routes.RefreshAccessToken).Methods("GET")
-
-	s.Use(middlewares.Authenticate)
 	// The path "/" matches everything not matched by some other path.
-	http.Handle("/", r)
+	http.Handle("/", routes.NewRouter())
 }
 
 func main() {
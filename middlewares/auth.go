@@ -7,23 +7,18 @@
 package middlewares
 
 import (
-	"encoding/base64"
+	gocontext "context"
 	"net/http"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
 	"github.com/gorilla/context"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // Authenticate : function to authenticate a request based on a particular header in the request
 func Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := appengine.NewContext(r)
+		ctx := models.NewContext(r)
 		anonymousEndpoints := make(map[string][]string)
 		anonymousEndpoints["POST"] = []string{
 			"/api/users", "/api/login",
@@ -49,51 +44,18 @@ func Authenticate(next http.Handler) http.Handler {
 			data["Message"] = "This request cannot be authenticated"
 			utils.SendResponse(w, 401, data, "fail", nil)
 		} else {
-			// Decode the token
-			decodedTokenInBytes, err := base64.StdEncoding.DecodeString(r.Header.Get("anima-prime-token"))
+			// Verify the signature, issuer, audience and expiry of the token
+			claims, err := utils.ParseAccessToken(r.Header.Get("anima-prime-token"))
 			if err != nil {
 				data := make(map[string]string)
-				data["Message"] = "Invalid access token"
-				utils.SendResponse(w, 400, data, "fail", nil)
-				return
-			}
-
-			// Check if it's already expired
-			decodedToken := utils.BytesToString(decodedTokenInBytes)
-			splitStrings := strings.Split(decodedToken, "|")
-			creationDate := splitStrings[1]
-			tokenAge, err3 := strconv.Atoi(splitStrings[2])
-			if err3 != nil {
-				utils.SendResponse(w, 500, err3.Error(), "error", nil)
-				return
-			}
-
-			t, err2 := time.Parse("2006-01-02T15:04:05Z", creationDate)
-			if err2 != nil {
-				utils.SendResponse(w, 500, err2.Error(), "error", nil)
-				return
-			}
-
-			expiryTime := t.AddDate(0, 0, tokenAge)
-
-			if time.Now().After(expiryTime) {
-				data := make(map[string]string)
-				data["Message"] = "Your token has expired."
+				data["Message"] = err.Error()
 				utils.SendResponse(w, 401, data, "fail", nil)
 				return
 			}
 
-			// Decode the key
-			key, err4 := datastore.DecodeKey(splitStrings[0])
-			if err4 != nil {
-				utils.SendResponse(w, 500, err4.Error(), "error", nil)
-				return
-			}
-
 			// Pass the requester's user key and authority to the handler
-			var userStruct models.User
-			err5 := datastore.Get(ctx, key, &userStruct)
-			if err5 == datastore.Done {
+			userStruct, err5 := models.Store.Users().Get(ctx, claims.Subject)
+			if err5 == models.ErrInvalidKey || err5 == models.ErrNotFound {
 				// The requester is not a registered user
 				data := make(map[string]string)
 				data["Email"] = "The requester is not recognized"
@@ -105,11 +67,27 @@ func Authenticate(next http.Handler) http.Handler {
 				return
 			}
 
+			// Check if the token has been revoked, either by logging out of its session
+			// or by revoking every token of the user
+			if claims.TokenVersion != userStruct.TokenVersion || !isSessionActive(ctx, claims) {
+				data := make(map[string]string)
+				data["Message"] = "Your token has been revoked."
+				utils.SendResponse(w, 401, data, "fail", nil)
+				return
+			}
+
 			context.Set(r, "currentUserAuthority", userStruct.Authority)
 			context.Set(r, "currentUserEmail", userStruct.Email)
-			context.Set(r, "currentUserKey", splitStrings[0])
+			context.Set(r, "currentUserKey", claims.Subject)
+			context.Set(r, "currentSessionKey", claims.SessionKey)
 
 			next.ServeHTTP(w, r)
 		}
 	})
 }
+
+// isSessionActive : check if the session an access token was issued for still exists
+func isSessionActive(ctx gocontext.Context, claims *utils.AccessClaims) bool {
+	session, err := models.Store.Sessions().Get(ctx, claims.SessionKey)
+	return err == nil && session.UserKey == claims.Subject
+}
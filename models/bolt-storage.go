@@ -0,0 +1,305 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltRepository : BoltDB implementation of Repository. Every kind lives in its own bucket,
+// keyed by a big-endian sequence number so iterating a bucket follows creation order
+type boltRepository[T any] struct {
+	db   *bolt.DB
+	kind string
+}
+
+func boltID(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func (b boltRepository[T]) decodeKey(key string) ([]byte, error) {
+	kind, id, err := decodeLocalKey(key)
+	if err != nil || kind != b.kind {
+		return nil, ErrInvalidKey
+	}
+
+	return boltID(id), nil
+}
+
+func (b boltRepository[T]) Get(ctx context.Context, key string) (T, error) {
+	var resource T
+
+	id, err := b.decodeKey(key)
+	if err != nil {
+		return resource, err
+	}
+
+	err = b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(b.kind)).Get(id)
+		if value == nil {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(value, &resource)
+	})
+
+	return resource, err
+}
+
+func (b boltRepository[T]) Create(ctx context.Context, resource T) (string, error) {
+	var key string
+
+	stampCreated(&resource)
+
+	value, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.kind))
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key = encodeLocalKey(b.kind, int64(id))
+		return bucket.Put(boltID(int64(id)), value)
+	})
+
+	return key, err
+}
+
+func (b boltRepository[T]) Update(ctx context.Context, key string, resource *T) error {
+	id, err := b.decodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	expected := VersionOf(resource)
+
+	// Read and write within the same transaction so nobody could update the entity in between
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.kind))
+
+		value := bucket.Get(id)
+		if value == nil {
+			return ErrNotFound
+		}
+
+		var current T
+		if err := json.Unmarshal(value, &current); err != nil {
+			return err
+		}
+
+		if err := bumpVersion(current, resource, expected); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(resource)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(id, value)
+	})
+}
+
+func (b boltRepository[T]) Delete(ctx context.Context, key string) error {
+	id, err := b.decodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.kind)).Delete(id)
+	})
+}
+
+// findAll : return every entity, in creation order, that satisfies match
+func (b boltRepository[T]) findAll(match func(T) bool) ([]Keyed[T], error) {
+	var result []Keyed[T]
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(b.kind)).Cursor()
+
+		for id, value := c.First(); id != nil; id, value = c.Next() {
+			var candidate T
+			if err := json.Unmarshal(value, &candidate); err != nil {
+				return err
+			}
+
+			if match(candidate) {
+				key := encodeLocalKey(b.kind, int64(binary.BigEndian.Uint64(id)))
+				result = append(result, Keyed[T]{key, candidate})
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (b boltRepository[T]) FindBy(ctx context.Context, field string, value interface{}) ([]Keyed[T], error) {
+	return b.findAll(func(resource T) bool { return fieldMatches(resource, field, value) })
+}
+
+func (b boltRepository[T]) List(ctx context.Context, query Query) (Page[T], error) {
+	resources, err := b.findAll(func(resource T) bool { return true })
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	return Paginate(resources, query)
+}
+
+// findOne : return the first entity, in creation order, that satisfies match
+func (b boltRepository[T]) findOne(match func(T) bool) (string, T, error) {
+	var resource T
+
+	result, err := b.findAll(match)
+	if err != nil {
+		return "", resource, err
+	}
+	if len(result) == 0 {
+		return "", resource, ErrNotFound
+	}
+
+	return result[0].Key, result[0].Resource, nil
+}
+
+type boltUserRepository struct {
+	boltRepository[User]
+}
+
+func (b boltUserRepository) FindByEmail(ctx context.Context, email string) (string, User, error) {
+	return b.findOne(func(u User) bool { return u.Email == email })
+}
+
+type boltSessionRepository struct {
+	boltRepository[Session]
+}
+
+func (b boltSessionRepository) FindByUser(ctx context.Context, userKey string) ([]Keyed[Session], error) {
+	return b.findAll(func(s Session) bool { return s.UserKey == userKey })
+}
+
+// BoltStorage : storage backend persisting every resource in a single BoltDB file
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// boltKinds : every bucket the BoltDB backend needs
+var boltKinds = []string{"users", "sessions", "campaigns", "invites", "characters", "drafts", "rolls", "commitments", "scenes", "conflicts", "powers", "eidolons"}
+
+// NewBoltStorage : function to open (or create) the BoltDB file at path
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	if path == "" {
+		path = "anima-prime.db"
+	}
+
+	// Don't hang forever when another process is holding the file lock
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range boltKinds {
+			if _, err := tx.CreateBucketIfNotExists([]byte(kind)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// Close : release the BoltDB file
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// NewContext : the BoltDB backend only needs the request's own context
+func (s *BoltStorage) NewContext(r *http.Request) context.Context {
+	return r.Context()
+}
+
+// Users : repository for users
+func (s *BoltStorage) Users() UserRepository {
+	return boltUserRepository{boltRepository[User]{s.db, "users"}}
+}
+
+// Sessions : repository for login sessions
+func (s *BoltStorage) Sessions() SessionRepository {
+	return boltSessionRepository{boltRepository[Session]{s.db, "sessions"}}
+}
+
+// Campaigns : repository for campaigns
+func (s *BoltStorage) Campaigns() CampaignRepository {
+	return boltRepository[Campaign]{s.db, "campaigns"}
+}
+
+// Invites : repository for campaign invites
+func (s *BoltStorage) Invites() InviteRepository {
+	return boltRepository[Invite]{s.db, "invites"}
+}
+
+// Characters : repository for characters
+func (s *BoltStorage) Characters() CharacterRepository {
+	return boltRepository[Character]{s.db, "characters"}
+}
+
+// Drafts : repository for character drafts
+func (s *BoltStorage) Drafts() DraftRepository {
+	return boltRepository[Draft]{s.db, "drafts"}
+}
+
+// Rolls : repository for rolls
+func (s *BoltStorage) Rolls() RollRepository {
+	return boltRepository[Roll]{s.db, "rolls"}
+}
+
+// Commitments : repository for the seeds of commit-reveal rolls
+func (s *BoltStorage) Commitments() CommitmentRepository {
+	return boltRepository[Commitment]{s.db, "commitments"}
+}
+
+// Scenes : repository for scenes
+func (s *BoltStorage) Scenes() SceneRepository {
+	return boltRepository[Scene]{s.db, "scenes"}
+}
+
+// Conflicts : repository for conflicts
+func (s *BoltStorage) Conflicts() ConflictRepository {
+	return boltRepository[Conflict]{s.db, "conflicts"}
+}
+
+// Powers : repository for powers
+func (s *BoltStorage) Powers() PowerRepository {
+	return boltRepository[Power]{s.db, "powers"}
+}
+
+// Eidolons : repository for eidolons
+func (s *BoltStorage) Eidolons() EidolonRepository {
+	return boltRepository[Eidolon]{s.db, "eidolons"}
+}
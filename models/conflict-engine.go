@@ -0,0 +1,339 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sides of a conflict
+const (
+	SideProtagonists = "protagonists"
+	SideOpposition   = "opposition"
+)
+
+// Actions a participant could take on their turn
+const (
+	StrikeAction          = "strike"
+	AchievementAction     = "achievement"
+	ChargePowerAction     = "chargePower"
+	CatchYourBreathAction = "catchYourBreath"
+)
+
+// Entries of the history of a conflict that don't take the turn of a participant
+const (
+	RollEntry          = "roll"
+	ActivatePowerEntry = "activatePower"
+)
+
+// Outcomes of a conflict resolved by its participants
+const (
+	OutcomeGoal    = "goal"
+	OutcomeVictory = "victory"
+	OutcomeDefeat  = "defeat"
+)
+
+// DefaultResilience : how many hits take a participant out unless told otherwise
+const DefaultResilience = 3
+
+// Error : implement error so the conflict engine could report what it refuses as a Violation.
+// Violations without a Field are about the state of the conflict rather than the arguments
+func (v Violation) Error() string {
+	return v.Message
+}
+
+// stateViolation : a violation about the state of the conflict
+func stateViolation(message string) Violation {
+	return Violation{Code: "state", Message: message}
+}
+
+// SpendsDice : whether an action spends strike dice
+func SpendsDice(actionType string) bool {
+	return actionType != CatchYourBreathAction
+}
+
+// Participant : the participant playing a character, or nil if the character doesn't take part
+func (c *Conflict) Participant(characterKey string) *ConflictParticipant {
+	for i := range c.Participants {
+		if c.Participants[i].CharacterKey == characterKey {
+			return &c.Participants[i]
+		}
+	}
+
+	return nil
+}
+
+// AddParticipant : bring a character into the conflict, before it starts or as reinforcements
+func (c *Conflict) AddParticipant(participant ConflictParticipant) error {
+	if c.IsResolved {
+		return stateViolation("This conflict is already resolved")
+	}
+	if c.Participant(participant.CharacterKey) != nil {
+		return Violation{Field: "CharacterKey", Code: "duplicate", Message: "This character already takes part in this conflict"}
+	}
+
+	if participant.Resilience == 0 {
+		participant.Resilience = DefaultResilience
+	}
+	participant.Hits = 0
+	participant.IsDefeated = false
+	participant.StrikeDice = 0
+	participant.ChargeDice = 0
+	// Reinforcements wait for the next round
+	participant.HasActed = c.IsStarted
+	participant.HasRolled = false
+
+	c.Participants = append(c.Participants, participant)
+	return nil
+}
+
+// RemoveParticipant : take a character out of the conflict. Returns false if it didn't take part
+func (c *Conflict) RemoveParticipant(characterKey string) (bool, error) {
+	if c.IsResolved {
+		return false, stateViolation("This conflict is already resolved")
+	}
+
+	// Taking the last of the opposition out still defeats it
+	hadOpposition := c.hasOpposition()
+	for i, participant := range c.Participants {
+		if participant.CharacterKey == characterKey {
+			c.Participants = append(c.Participants[:i], c.Participants[i+1:]...)
+			// They may have been the last one standing on their side, or the one the round was waiting for
+			c.resolveIfOver(hadOpposition)
+			if !c.IsResolved {
+				c.nextRoundIfDone()
+			}
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Start : open the first round. The protagonists need at least one participant
+func (c *Conflict) Start() error {
+	if c.IsResolved {
+		return stateViolation("This conflict is already resolved")
+	}
+	if c.IsStarted {
+		return stateViolation("This conflict has already started")
+	}
+	if len(c.standing(SideProtagonists)) == 0 {
+		return stateViolation("A conflict needs at least one protagonist to start")
+	}
+
+	c.IsStarted = true
+	c.Round = 1
+	c.AchievementPoints = 0
+	for i := range c.Participants {
+		c.Participants[i].HasActed = false
+		c.Participants[i].HasRolled = false
+		c.Participants[i].StrikeDice = 0
+		c.Participants[i].ChargeDice = 0
+	}
+
+	return nil
+}
+
+// AddRoll : put the successes of a roll made for a participant into their strike dice,
+// after taking the charge dice added to the roll out of their charge dice.
+// Participants roll once per round, before acting on what they rolled
+func (c *Conflict) AddRoll(characterKey string, rollKey string, successes int, chargeDice int) error {
+	roller, err := c.activeParticipant(characterKey)
+	if err != nil {
+		return err
+	}
+	if roller.HasActed {
+		return stateViolation("This character has already acted this round")
+	}
+	if roller.HasRolled {
+		return stateViolation("This character has already rolled this round")
+	}
+	if chargeDice > roller.ChargeDice {
+		return insufficientDice("ChargeDice", roller.ChargeDice, "charge")
+	}
+
+	roller.ChargeDice -= chargeDice
+	roller.StrikeDice += successes
+	roller.HasRolled = true
+	c.record(ConflictAction{CharacterKey: characterKey, Type: RollEntry, RollKey: rollKey, Dice: successes})
+
+	return nil
+}
+
+// ActivatePower : spend charge dice of a participant to activate one of their powers. It doesn't take a turn either
+func (c *Conflict) ActivatePower(characterKey string, powerKey string, dice int) error {
+	activator, err := c.activeParticipant(characterKey)
+	if err != nil {
+		return err
+	}
+	if dice > activator.ChargeDice {
+		return insufficientDice("Dice", activator.ChargeDice, "charge")
+	}
+
+	activator.ChargeDice -= dice
+	c.record(ConflictAction{CharacterKey: characterKey, Type: ActivatePowerEntry, PowerKey: powerKey, Dice: dice})
+
+	return nil
+}
+
+// Act : take the turn of a participant and apply its effects. Opens the next round once every participant
+// still standing has acted, and resolves the conflict when its goal is met or a side is defeated
+func (c *Conflict) Act(action ConflictAction) error {
+	actor, err := c.activeParticipant(action.CharacterKey)
+	if err != nil {
+		return err
+	}
+	if actor.HasActed {
+		return stateViolation("This character has already acted this round")
+	}
+
+	if SpendsDice(action.Type) && action.Dice > actor.StrikeDice {
+		return insufficientDice("Dice", actor.StrikeDice, "strike")
+	}
+
+	switch action.Type {
+	case StrikeAction:
+		target := c.Participant(action.TargetKey)
+		switch {
+		case target == nil:
+			return Violation{Field: "TargetKey", Code: "unknown", Message: "This character doesn't take part in this conflict"}
+		case target.Side == actor.Side:
+			return Violation{Field: "TargetKey", Code: "sameSide", Message: "Only the other side could be struck"}
+		case target.IsDefeated:
+			return Violation{Field: "TargetKey", Code: "defeated", Message: "This character is already out of the conflict"}
+		}
+
+		target.Hits += action.Dice
+		target.IsDefeated = target.Hits >= target.Resilience
+	case AchievementAction:
+		if actor.Side != SideProtagonists {
+			return Violation{Field: "Type", Code: "notAllowed", Message: "Only protagonists work toward the goal"}
+		}
+		c.AchievementPoints += action.Dice
+	case ChargePowerAction:
+		actor.ChargeDice += action.Dice
+	case CatchYourBreathAction:
+		actor.Hits = 0
+		action.Dice = 0
+	default:
+		return Violation{Field: "Type", Code: "enum", Message: "There is no such action"}
+	}
+
+	actor.StrikeDice -= action.Dice
+	actor.HasActed = true
+	c.record(action)
+
+	c.resolveIfOver(c.hasOpposition())
+	if !c.IsResolved {
+		c.nextRoundIfDone()
+	}
+
+	return nil
+}
+
+// activeParticipant : the participant playing a character, as long as they could still do something in the conflict
+func (c *Conflict) activeParticipant(characterKey string) (*ConflictParticipant, error) {
+	if c.IsResolved {
+		return nil, stateViolation("This conflict is already resolved")
+	}
+	if !c.IsStarted {
+		return nil, stateViolation("This conflict hasn't started yet")
+	}
+
+	participant := c.Participant(characterKey)
+	if participant == nil {
+		return nil, Violation{Field: "CharacterKey", Code: "unknown", Message: "This character doesn't take part in this conflict"}
+	}
+	if participant.IsDefeated {
+		return nil, stateViolation("This character is out of the conflict")
+	}
+
+	return participant, nil
+}
+
+// record : add an entry to the history of the conflict
+func (c *Conflict) record(entry ConflictAction) {
+	entry.Round = c.Round
+	entry.CreatedAt = time.Now().UTC()
+	c.Actions = append(c.Actions, entry)
+}
+
+// insufficientDice : a violation for spending more dice than a participant has
+func insufficientDice(field string, left int, pool string) Violation {
+	message := fmt.Sprintf("Only %v %v dice are left", left, pool)
+	if left == 1 {
+		message = fmt.Sprintf("Only 1 %v die is left", pool)
+	}
+
+	return Violation{Field: field, Code: "insufficient", Message: message}
+}
+
+// standing : the participants of a side who aren't out of the conflict
+func (c *Conflict) standing(side string) []*ConflictParticipant {
+	var participants []*ConflictParticipant
+	for i := range c.Participants {
+		if c.Participants[i].Side == side && !c.Participants[i].IsDefeated {
+			participants = append(participants, &c.Participants[i])
+		}
+	}
+
+	return participants
+}
+
+// nextRoundIfDone : open the next round once every participant still standing has acted
+func (c *Conflict) nextRoundIfDone() {
+	if !c.IsStarted || c.IsResolved {
+		return
+	}
+
+	standing := append(c.standing(SideProtagonists), c.standing(SideOpposition)...)
+	for _, participant := range standing {
+		if !participant.HasActed {
+			return
+		}
+	}
+
+	c.Round++
+	for i := range c.Participants {
+		c.Participants[i].HasActed = false
+		c.Participants[i].HasRolled = false
+	}
+}
+
+// hasOpposition : whether anyone takes part on the side of the opposition, defeated or not
+func (c *Conflict) hasOpposition() bool {
+	for _, participant := range c.Participants {
+		if participant.Side == SideOpposition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveIfOver : resolve the conflict when its goal is met or a side is defeated.
+// A conflict without opposition could only be won by meeting its goal
+func (c *Conflict) resolveIfOver(hadOpposition bool) {
+	if !c.IsStarted || c.IsResolved {
+		return
+	}
+
+	switch {
+	case c.Difficulty > 0 && c.AchievementPoints >= c.Difficulty:
+		c.Outcome = OutcomeGoal
+	case hadOpposition && len(c.standing(SideOpposition)) == 0:
+		c.Outcome = OutcomeVictory
+	case len(c.standing(SideProtagonists)) == 0:
+		c.Outcome = OutcomeDefeat
+	default:
+		return
+	}
+
+	c.IsResolved = true
+}
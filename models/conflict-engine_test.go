@@ -0,0 +1,392 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// newConflict : a conflict with two protagonists against one foe, before it starts
+func newConflict() *Conflict {
+	return &Conflict{
+		Difficulty: 5,
+		Participants: []ConflictParticipant{
+			{CharacterKey: "hero", Side: SideProtagonists, Resilience: 2},
+			{CharacterKey: "sidekick", Side: SideProtagonists, Resilience: 1},
+			{CharacterKey: "foe", Side: SideOpposition, Resilience: 2},
+		},
+	}
+}
+
+// startedConflict : newConflict in its first round, with strike dice already rolled for everyone
+func startedConflict(t *testing.T) *Conflict {
+	c := newConflict()
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range c.Participants {
+		c.Participants[i].StrikeDice = 5
+		c.Participants[i].ChargeDice = 2
+	}
+
+	return c
+}
+
+// checkViolation : fail unless err is a Violation for field with code, or no error when code is empty
+func checkViolation(t *testing.T, err error, field string, code string) {
+	t.Helper()
+
+	if code == "" {
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return
+	}
+
+	var violation Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("got %v, want a violation %v on %q", err, code, field)
+	}
+	if violation.Field != field || violation.Code != code {
+		t.Fatalf("got violation %v on %q, want %v on %q", violation.Code, violation.Field, code, field)
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *Conflict)
+		code  string
+	}{
+		{"opens the first round", func(c *Conflict) {}, ""},
+		{"needs a protagonist", func(c *Conflict) { c.Participants = c.Participants[2:] }, "state"},
+		{"only once", func(c *Conflict) { c.IsStarted = true }, "state"},
+		{"not once resolved", func(c *Conflict) { c.IsResolved = true }, "state"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newConflict()
+			c.Participants[0].StrikeDice = 3
+			c.Participants[0].HasActed = true
+			test.setup(c)
+
+			err := c.Start()
+			checkViolation(t, err, "", test.code)
+			if err != nil {
+				return
+			}
+
+			if !c.IsStarted || c.Round != 1 {
+				t.Errorf("started %v in round %v, want round 1", c.IsStarted, c.Round)
+			}
+			if hero := c.Participant("hero"); hero.StrikeDice != 0 || hero.HasActed {
+				t.Errorf("hero kept %v strike dice and acted %v", hero.StrikeDice, hero.HasActed)
+			}
+		})
+	}
+}
+
+func TestAddRoll(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(c *Conflict)
+		character  string
+		chargeDice int
+		field      string
+		code       string
+	}{
+		{"adds the successes", func(c *Conflict) {}, "hero", 2, "", ""},
+		{"not before the conflict starts", func(c *Conflict) { c.IsStarted = false }, "hero", 0, "", "state"},
+		{"only participants", func(c *Conflict) {}, "stranger", 0, "CharacterKey", "unknown"},
+		{"not once out", func(c *Conflict) { c.Participant("hero").IsDefeated = true }, "hero", 0, "", "state"},
+		{"once per round", func(c *Conflict) { c.Participant("hero").HasRolled = true }, "hero", 0, "", "state"},
+		{"before acting", func(c *Conflict) { c.Participant("hero").HasActed = true }, "hero", 0, "", "state"},
+		{"within the charge dice", func(c *Conflict) {}, "hero", 3, "ChargeDice", "insufficient"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := startedConflict(t)
+			test.setup(c)
+
+			err := c.AddRoll(test.character, "roll", 4, test.chargeDice)
+			checkViolation(t, err, test.field, test.code)
+			if err != nil {
+				return
+			}
+
+			hero := c.Participant("hero")
+			if hero.StrikeDice != 9 || hero.ChargeDice != 0 || !hero.HasRolled {
+				t.Errorf("got %v strike dice, %v charge dice and rolled %v, want 9, 0 and true", hero.StrikeDice, hero.ChargeDice, hero.HasRolled)
+			}
+			if last := c.Actions[len(c.Actions)-1]; last.Type != RollEntry || last.RollKey != "roll" || last.Dice != 4 {
+				t.Errorf("recorded %+v", last)
+			}
+		})
+	}
+}
+
+func TestRollThenAct(t *testing.T) {
+	c := newConflict()
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkViolation(t, c.Act(ConflictAction{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 1}), "Dice", "insufficient")
+
+	checkViolation(t, c.AddRoll("hero", "roll", 1, 0), "", "")
+	checkViolation(t, c.Act(ConflictAction{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 1}), "", "")
+	checkViolation(t, c.AddRoll("hero", "again", 1, 0), "", "state")
+}
+
+func TestActivatePower(t *testing.T) {
+	tests := []struct {
+		name string
+		dice int
+		code string
+	}{
+		{"spends charge dice", 2, ""},
+		{"within the charge dice", 3, "insufficient"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := startedConflict(t)
+
+			err := c.ActivatePower("hero", "power", test.dice)
+			if test.code != "" {
+				checkViolation(t, err, "Dice", test.code)
+				return
+			}
+			checkViolation(t, err, "", "")
+
+			// Activating a power doesn't take the turn
+			if hero := c.Participant("hero"); hero.ChargeDice != 0 || hero.HasActed {
+				t.Errorf("got %v charge dice and acted %v, want 0 and false", hero.ChargeDice, hero.HasActed)
+			}
+		})
+	}
+}
+
+func TestAct(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(c *Conflict)
+		actions []ConflictAction
+		field   string
+		code    string
+		check   func(t *testing.T, c *Conflict)
+	}{
+		{
+			name:    "strikes the other side",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 1}},
+			check: func(t *testing.T, c *Conflict) {
+				if foe := c.Participant("foe"); foe.Hits != 1 || foe.IsDefeated {
+					t.Errorf("foe took %v hits and defeated %v", foe.Hits, foe.IsDefeated)
+				}
+				if hero := c.Participant("hero"); hero.StrikeDice != 4 || !hero.HasActed {
+					t.Errorf("hero has %v strike dice and acted %v", hero.StrikeDice, hero.HasActed)
+				}
+			},
+		},
+		{
+			name:    "within the strike dice",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 6}},
+			field:   "Dice",
+			code:    "insufficient",
+		},
+		{
+			name:    "not the same side",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: StrikeAction, TargetKey: "sidekick", Dice: 1}},
+			field:   "TargetKey",
+			code:    "sameSide",
+		},
+		{
+			name:    "not someone already out",
+			setup:   func(c *Conflict) { c.Participant("sidekick").IsDefeated = true },
+			actions: []ConflictAction{{CharacterKey: "foe", Type: StrikeAction, TargetKey: "sidekick", Dice: 1}},
+			field:   "TargetKey",
+			code:    "defeated",
+		},
+		{
+			name:    "only protagonists achieve",
+			actions: []ConflictAction{{CharacterKey: "foe", Type: AchievementAction, Dice: 1}},
+			field:   "Type",
+			code:    "notAllowed",
+		},
+		{
+			name:    "only known actions",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: "dance"}},
+			field:   "Type",
+			code:    "enum",
+		},
+		{
+			name: "once per round",
+			actions: []ConflictAction{
+				{CharacterKey: "hero", Type: CatchYourBreathAction},
+				{CharacterKey: "hero", Type: CatchYourBreathAction},
+			},
+			code: "state",
+		},
+		{
+			name:    "charges powers",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: ChargePowerAction, Dice: 3}},
+			check: func(t *testing.T, c *Conflict) {
+				if hero := c.Participant("hero"); hero.ChargeDice != 5 || hero.StrikeDice != 2 {
+					t.Errorf("hero has %v charge dice and %v strike dice, want 5 and 2", hero.ChargeDice, hero.StrikeDice)
+				}
+			},
+		},
+		{
+			name: "opens the next round once everyone acted",
+			setup: func(c *Conflict) {
+				c.Participant("hero").HasRolled = true
+			},
+			actions: []ConflictAction{
+				{CharacterKey: "hero", Type: CatchYourBreathAction},
+				{CharacterKey: "sidekick", Type: CatchYourBreathAction},
+				{CharacterKey: "foe", Type: CatchYourBreathAction},
+			},
+			check: func(t *testing.T, c *Conflict) {
+				if c.Round != 2 {
+					t.Errorf("in round %v, want 2", c.Round)
+				}
+				for _, participant := range c.Participants {
+					if participant.HasActed || participant.HasRolled {
+						t.Errorf("%v acted %v and rolled %v in the new round", participant.CharacterKey, participant.HasActed, participant.HasRolled)
+					}
+				}
+			},
+		},
+		{
+			name: "skips those already out",
+			setup: func(c *Conflict) {
+				c.Participant("sidekick").IsDefeated = true
+			},
+			actions: []ConflictAction{
+				{CharacterKey: "hero", Type: CatchYourBreathAction},
+				{CharacterKey: "foe", Type: CatchYourBreathAction},
+			},
+			check: func(t *testing.T, c *Conflict) {
+				if c.Round != 2 {
+					t.Errorf("in round %v, want 2", c.Round)
+				}
+			},
+		},
+		{
+			name: "meets the goal",
+			actions: []ConflictAction{
+				{CharacterKey: "hero", Type: AchievementAction, Dice: 3},
+				{CharacterKey: "sidekick", Type: AchievementAction, Dice: 2},
+			},
+			check: func(t *testing.T, c *Conflict) {
+				if !c.IsResolved || c.Outcome != OutcomeGoal {
+					t.Errorf("resolved %v with %q, want %q", c.IsResolved, c.Outcome, OutcomeGoal)
+				}
+			},
+		},
+		{
+			name:    "defeats the opposition",
+			actions: []ConflictAction{{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 2}},
+			check: func(t *testing.T, c *Conflict) {
+				if !c.IsResolved || c.Outcome != OutcomeVictory {
+					t.Errorf("resolved %v with %q, want %q", c.IsResolved, c.Outcome, OutcomeVictory)
+				}
+			},
+		},
+		{
+			name:    "loses every protagonist",
+			setup:   func(c *Conflict) { c.Participant("sidekick").IsDefeated = true },
+			actions: []ConflictAction{{CharacterKey: "foe", Type: StrikeAction, TargetKey: "hero", Dice: 2}},
+			check: func(t *testing.T, c *Conflict) {
+				if !c.IsResolved || c.Outcome != OutcomeDefeat {
+					t.Errorf("resolved %v with %q, want %q", c.IsResolved, c.Outcome, OutcomeDefeat)
+				}
+			},
+		},
+		{
+			name: "nothing once resolved",
+			actions: []ConflictAction{
+				{CharacterKey: "hero", Type: StrikeAction, TargetKey: "foe", Dice: 2},
+				{CharacterKey: "sidekick", Type: CatchYourBreathAction},
+			},
+			code: "state",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := startedConflict(t)
+			if test.setup != nil {
+				test.setup(c)
+			}
+
+			var err error
+			for _, action := range test.actions {
+				if err = c.Act(action); err != nil {
+					break
+				}
+			}
+
+			checkViolation(t, err, test.field, test.code)
+			if test.check != nil {
+				test.check(t, c)
+			}
+		})
+	}
+}
+
+func TestRemoveParticipant(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(c *Conflict)
+		character string
+		removed   bool
+		code      string
+		round     int
+		outcome   string
+	}{
+		{"only participants", func(c *Conflict) {}, "stranger", false, "", 1, ""},
+		{"someone of a side still standing", func(c *Conflict) {}, "sidekick", true, "", 1, ""},
+		{
+			"the one the round was waiting for",
+			func(c *Conflict) {
+				c.Participant("hero").HasActed = true
+				c.Participant("foe").HasActed = true
+			},
+			"sidekick", true, "", 2, "",
+		},
+		{"the last of the opposition", func(c *Conflict) {}, "foe", true, "", 1, OutcomeVictory},
+		{
+			"the last protagonist standing",
+			func(c *Conflict) { c.Participant("sidekick").IsDefeated = true },
+			"hero", true, "", 1, OutcomeDefeat,
+		},
+		{"not once resolved", func(c *Conflict) { c.IsResolved = true }, "foe", false, "state", 1, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := startedConflict(t)
+			test.setup(c)
+
+			removed, err := c.RemoveParticipant(test.character)
+			checkViolation(t, err, "", test.code)
+			if removed != test.removed {
+				t.Errorf("removed %v, want %v", removed, test.removed)
+			}
+			if removed && c.Participant(test.character) != nil {
+				t.Errorf("%v still takes part", test.character)
+			}
+			if c.Round != test.round || c.Outcome != test.outcome || c.IsResolved != (test.outcome != "" || test.code != "") {
+				t.Errorf("in round %v resolved %v with %q, want round %v with %q", c.Round, c.IsResolved, c.Outcome, test.round, test.outcome)
+			}
+		})
+	}
+}
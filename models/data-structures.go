@@ -6,7 +6,87 @@
 
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/dorklord23/anima-prime/utils"
+)
+
+// campaigns.go
+
+// Campaign : data structure for campaigns, the game a GM runs for a roster of players.
+// Characters, scenes and conflicts join a campaign through their CampaignKey.
+// The creator (ParentKey) owns the campaign
+type Campaign struct {
+	Name        string
+	Description string
+	GMKey       string
+	CoGMs       []string
+	Players     []string
+	Spectators  []string
+	// HouseRules : the character creation rules set by the GM, only followed when HasHouseRules is set
+	HouseRules    Rules
+	HasHouseRules bool
+	ParentKey     string
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+	Version       int64
+}
+
+// RoleOf : the most privileged role a user has in this campaign
+func (c Campaign) RoleOf(userKey string) Role {
+	switch {
+	case userKey == "":
+		return RoleNone
+	case c.ParentKey == userKey:
+		return RoleOwner
+	case c.GMKey == userKey:
+		return RoleGM
+	case utils.Contains(c.CoGMs, userKey):
+		return RoleCoGM
+	case utils.Contains(c.Players, userKey):
+		return RolePlayer
+	case utils.Contains(c.Spectators, userKey):
+		return RoleSpectator
+	default:
+		return RoleNone
+	}
+}
+
+// AddMember : put a user on the roster with a given role. The GM and the owner are left alone
+func (c *Campaign) AddMember(userKey string, role Role) {
+	switch role {
+	case RoleCoGM:
+		c.CoGMs = append(c.CoGMs, userKey)
+	case RolePlayer:
+		c.Players = append(c.Players, userKey)
+	case RoleSpectator:
+		c.Spectators = append(c.Spectators, userKey)
+	}
+}
+
+// RemoveMember : take a user off every list of the roster
+func (c *Campaign) RemoveMember(userKey string) {
+	c.CoGMs = utils.Remove(c.CoGMs, userKey)
+	c.Players = utils.Remove(c.Players, userKey)
+	c.Spectators = utils.Remove(c.Spectators, userKey)
+}
+
+// Invite : an invitation code a GM hands out so users could join their campaign
+type Invite struct {
+	CampaignKey string
+	Code        string
+	Role        Role
+	ExpiresAt   time.Time
+	// MaxUses : how many users could accept this invite. Zero means unlimited
+	MaxUses    int
+	AcceptedBy []string
+	DeclinedBy []string
+	ParentKey  string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Version    int64
+}
 
 // characters.go
 
@@ -24,29 +104,119 @@ type Trait struct {
 
 // Character : data structure for characters
 type Character struct {
-	Name       string
-	Concept    string
-	Mark       string
-	Passion    string
-	Traits     []Trait
-	Skills     []Skill
-	Powers     []string
-	Background string
-	Links      []string
+	Name        string
+	Concept     string
+	Mark        string
+	Passion     string
+	Traits      []Trait
+	Skills      []Skill
+	Powers      []string
+	Background  string
+	Links       []string
+	CampaignKey string
+	ParentKey   string
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+	Version     int64
+}
+
+// Draft : a character being created step by step, kept server-side so its creator could resume it on another device.
+// It becomes a Character once finalized
+type Draft struct {
+	Name        string
+	Concept     string
+	Mark        string
+	Passion     string
+	Traits      []Trait
+	Skills      []Skill
+	Powers      []string
+	Background  string
+	Links       []string
+	CampaignKey string
+	// Steps : the steps filled so far
+	Steps      []string
 	ParentKey  string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Version    int64
+}
+
+// Character : the character this draft becomes once finalized
+func (d Draft) Character() Character {
+	return Character{
+		Name:        d.Name,
+		Concept:     d.Concept,
+		Mark:        d.Mark,
+		Passion:     d.Passion,
+		Traits:      d.Traits,
+		Skills:      d.Skills,
+		Powers:      d.Powers,
+		Background:  d.Background,
+		Links:       d.Links,
+		CampaignKey: d.CampaignKey,
+		ParentKey:   d.ParentKey,
+	}
 }
 
 // conflicts.go
 
-// Conflict : data structure for conflicts
+// ConflictParticipant : a character taking part in a conflict, on either side
+type ConflictParticipant struct {
+	CharacterKey string
+	Side         string
+	// Resilience : how many hits take the participant out of the conflict
+	Resilience int
+	Hits       int
+	IsDefeated bool
+	// HasActed : whether the participant has acted this round
+	HasActed bool
+	// HasRolled : whether the participant has rolled this round
+	HasRolled bool
+	// StrikeDice : the successes rolled during the conflict and not spent yet
+	StrikeDice int
+	// ChargeDice : the dice banked to activate powers or add to rolls
+	ChargeDice int
+}
+
+// ConflictAction : an entry of the history of a conflict, either an action a participant took on their turn,
+// a roll or the activation of a power
+type ConflictAction struct {
+	Round        int
+	CharacterKey string
+	Type         string
+	// TargetKey : the participant struck, for strikes
+	TargetKey string
+	// RollKey : the roll, for rolls
+	RollKey string
+	// PowerKey : the power activated, for activations
+	PowerKey string
+	// Dice : the dice gained by a roll, or spent otherwise
+	Dice      int
+	CreatedAt time.Time
+}
+
+// Conflict : data structure for conflicts.
+// Once started, its participants take turns until the goal is met or a side is defeated
 type Conflict struct {
 	Name        string
 	Description string
 	Goal        string
-	Difficulty  int
-	Targets     []string
-	IsResolved  bool
+	// Difficulty : how many achievement points meet the goal. Zero when the goal can't be achieved that way
+	Difficulty        int
+	Targets           []string
+	Participants      []ConflictParticipant
+	IsStarted         bool
+	Round             int
+	AchievementPoints int
+	Actions           []ConflictAction
+	IsResolved        bool
+	// Outcome : how the conflict was resolved. Empty when a GM resolved it by hand
+	Outcome     string
+	CampaignKey string
 	ParentKey   string
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+	Version     int64
 }
 
 // eidolons.go
@@ -61,6 +231,9 @@ type Eidolon struct {
 	Powers      []int
 	Weakness    int
 	ParentKey   string
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+	Version     int64
 }
 
 // powers.go
@@ -85,8 +258,11 @@ type Power struct {
 	Description string
 	Type        int
 	// Effect : array of StatusChange keys
-	Effect    []string
-	ParentKey string
+	Effect     []string
+	ParentKey  string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Version    int64
 }
 
 // ApplyEffect : apply this particular power's effect
@@ -94,6 +270,59 @@ func (p Power) ApplyEffect() {
 	// Do nothing for now
 }
 
+// rolls.go
+
+// RolledDie : a die of a roll along with where it comes from.
+// Detail tells which trait or scene bonus granted it
+type RolledDie struct {
+	Source    string
+	Detail    string
+	Value     int
+	IsSuccess bool
+}
+
+// Roll : a skill roll, kept so players could check each other's rolls and the GM could review them
+type Roll struct {
+	CharacterKey string
+	SkillID      string
+	Rating       int
+	// Threshold : the lowest value a die needs to show to count as a success
+	Threshold int
+	Dice      []RolledDie
+	Successes int
+	// Purpose : what the roll is for, in the words of the roller
+	Purpose     string
+	SceneKey    string
+	ConflictKey string
+	// CampaignKey : the campaign the character was in when rolling, whose members could see the roll
+	CampaignKey string
+	// CommitmentKey, SeedHash, ServerSeed, ClientSeed : how the dice of a commit-reveal roll could be recomputed.
+	// Empty for the other rolls
+	CommitmentKey string
+	SeedHash      string
+	ServerSeed    string
+	ClientSeed    string
+	// ParentKey : the user who rolled
+	ParentKey  string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Version    int64
+}
+
+// Commitment : a secret seed the server commits to by publishing its hash before a roll, and reveals once it's used
+type Commitment struct {
+	// Hash : hex-encoded SHA-256 of the seed
+	Hash string
+	// Seed : hex-encoded, kept secret until used
+	Seed   string
+	IsUsed bool
+	// ParentKey : the user who asked for it, the only one who could roll with it
+	ParentKey  string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Version    int64
+}
+
 // scenes.go
 
 // SceneBonus : data structure for scene bonus
@@ -108,18 +337,40 @@ type Scene struct {
 	Description string
 	IsResolved  bool
 	Bonus       []SceneBonus
+	CampaignKey string
 	ParentKey   string
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+	Version     int64
+}
+
+// sessions.go
+
+// Session : a device a user is logged in from. Every refresh token issued to this device through
+// rotation belongs to the same session so replaying an already rotated token revokes all of them
+type Session struct {
+	UserKey   string
+	Device    string
+	TokenHash string
+	// RotatedHashes : hashes of refresh tokens this session has already rotated away from
+	RotatedHashes []string
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+	ModifiedAt    time.Time
+	Version       int64
 }
 
 // users.go
 
 // User : struct to hold user data to commit to Datastore
 type User struct {
-	FullName     string
-	Email        string
-	Hash         string
-	Authority    string
-	RefreshToken string
+	FullName  string
+	Email     string
+	Hash      string
+	Authority string
+	// TokenVersion : bumped to revoke every access token issued to this user so far
+	TokenVersion int
 	CreatedAt    time.Time
 	ModifiedAt   time.Time
+	Version      int64
 }
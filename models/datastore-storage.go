@@ -0,0 +1,320 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// datastoreRepository : Google Datastore implementation of Repository for a single kind
+type datastoreRepository[T any] struct {
+	kind string
+}
+
+func (d datastoreRepository[T]) decodeKey(key string) (*datastore.Key, error) {
+	decodedKey, err := datastore.DecodeKey(key)
+	if err != nil || decodedKey.Kind() != d.kind {
+		return nil, ErrInvalidKey
+	}
+
+	return decodedKey, nil
+}
+
+func (d datastoreRepository[T]) Get(ctx context.Context, key string) (T, error) {
+	var resource T
+
+	decodedKey, err := d.decodeKey(key)
+	if err != nil {
+		return resource, err
+	}
+
+	err = ignoreFieldMismatch(datastore.Get(ctx, decodedKey, &resource))
+	if err == datastore.ErrNoSuchEntity {
+		return resource, ErrNotFound
+	}
+
+	return resource, err
+}
+
+// ignoreFieldMismatch : entities written before a field was removed from its struct still load fine
+func ignoreFieldMismatch(err error) error {
+	if _, ok := err.(*datastore.ErrFieldMismatch); ok {
+		return nil
+	}
+
+	return err
+}
+
+func (d datastoreRepository[T]) Create(ctx context.Context, resource T) (string, error) {
+	stampCreated(&resource)
+
+	key, err := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, d.kind, nil), &resource)
+	if err != nil {
+		return "", err
+	}
+
+	return key.Encode(), nil
+}
+
+func (d datastoreRepository[T]) Update(ctx context.Context, key string, resource *T) error {
+	decodedKey, err := d.decodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	expected := VersionOf(resource)
+
+	// Read and write within a transaction so nobody could update the entity in between
+	return datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		var current T
+
+		err := ignoreFieldMismatch(datastore.Get(tc, decodedKey, &current))
+		if err == datastore.ErrNoSuchEntity {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := bumpVersion(current, resource, expected); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(tc, decodedKey, resource)
+		return err
+	}, nil)
+}
+
+func (d datastoreRepository[T]) Delete(ctx context.Context, key string) error {
+	decodedKey, err := d.decodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	return datastore.Delete(ctx, decodedKey)
+}
+
+// findOne : return the first entity whose property equals value
+func (d datastoreRepository[T]) findOne(ctx context.Context, property string, value interface{}) (string, T, error) {
+	var resource T
+
+	t := datastore.NewQuery(d.kind).Filter(property+" =", value).Limit(1).Run(ctx)
+	key, err := t.Next(&resource)
+	if err == datastore.Done {
+		return "", resource, ErrNotFound
+	}
+	if err = ignoreFieldMismatch(err); err != nil {
+		return "", resource, err
+	}
+
+	return key.Encode(), resource, nil
+}
+
+func (d datastoreRepository[T]) FindBy(ctx context.Context, property string, value interface{}) ([]Keyed[T], error) {
+	var result []Keyed[T]
+
+	t := datastore.NewQuery(d.kind).Filter(property+" =", value).Run(ctx)
+	for {
+		var resource T
+
+		key, err := t.Next(&resource)
+		if err == datastore.Done {
+			return result, nil
+		}
+		if err = ignoreFieldMismatch(err); err != nil {
+			return nil, err
+		}
+
+		result = append(result, Keyed[T]{key.Encode(), resource})
+	}
+}
+
+// datastoreSorts : the fields each kind could be sorted by, per filter, mirroring the composite indexes in index.yaml
+var datastoreSorts = map[string]map[string][]string{
+	"characters": {"ParentKey": {"Name", "CreatedAt", "ModifiedAt"}, "CampaignKey": {"Name", "CreatedAt", "ModifiedAt"}},
+	"drafts":     {"ParentKey": {"Name", "CreatedAt", "ModifiedAt"}},
+	"scenes":     {"ParentKey": {"Name", "CreatedAt", "ModifiedAt"}, "CampaignKey": {"Name", "CreatedAt", "ModifiedAt"}},
+	"conflicts": {
+		"ParentKey":   {"Name", "Difficulty", "CreatedAt", "ModifiedAt"},
+		"CampaignKey": {"Name", "Difficulty", "CreatedAt", "ModifiedAt"},
+	},
+	"powers":   {"ParentKey": {"Name", "Type", "CreatedAt", "ModifiedAt"}},
+	"eidolons": {"ParentKey": {"Name", "Level", "Type", "CreatedAt", "ModifiedAt"}},
+	"invites":  {"CampaignKey": {"CreatedAt", "ExpiresAt"}},
+	"sessions": {"UserKey": {"CreatedAt", "LastUsedAt"}},
+	"rolls": {
+		"CharacterKey": {"Successes", "CreatedAt"},
+		"SceneKey":     {"Successes", "CreatedAt"},
+		"ConflictKey":  {"Successes", "CreatedAt"},
+	},
+}
+
+// isIndexed : sorting along with filters needs a composite index so only a single filter listed in datastoreSorts is allowed
+func (d datastoreRepository[T]) isIndexed(query Query) bool {
+	if query.Sort == "" || len(query.Filters) == 0 {
+		return true
+	}
+	if len(query.Filters) > 1 {
+		return false
+	}
+
+	return slices.Contains(datastoreSorts[d.kind][query.Filters[0].Field], query.Sort)
+}
+
+func (d datastoreRepository[T]) List(ctx context.Context, query Query) (Page[T], error) {
+	var page Page[T]
+
+	if !d.isIndexed(query) {
+		return page, ErrUnsortable
+	}
+
+	q := datastore.NewQuery(d.kind)
+	for _, filter := range query.Filters {
+		q = q.Filter(filter.Field+" =", filter.Value)
+	}
+
+	if query.Sort != "" {
+		if query.Descending {
+			q = q.Order("-" + query.Sort)
+		} else {
+			q = q.Order(query.Sort)
+		}
+	}
+
+	if query.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(query.Cursor)
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+		q = q.Start(cursor)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	t := q.Limit(limit).Run(ctx)
+	for {
+		var resource T
+
+		key, err := t.Next(&resource)
+		if err == datastore.Done {
+			break
+		}
+		if err = ignoreFieldMismatch(err); err != nil {
+			return page, err
+		}
+
+		page.Items = append(page.Items, Keyed[T]{key.Encode(), resource})
+	}
+
+	// A full page means there may be more to come
+	if len(page.Items) == limit {
+		cursor, err := t.Cursor()
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = cursor.String()
+	}
+
+	return page, nil
+}
+
+type datastoreUserRepository struct {
+	datastoreRepository[User]
+}
+
+func (d datastoreUserRepository) FindByEmail(ctx context.Context, email string) (string, User, error) {
+	return d.findOne(ctx, "Email", email)
+}
+
+type datastoreSessionRepository struct {
+	datastoreRepository[Session]
+}
+
+func (d datastoreSessionRepository) FindByUser(ctx context.Context, userKey string) ([]Keyed[Session], error) {
+	return d.FindBy(ctx, "UserKey", userKey)
+}
+
+// DatastoreStorage : storage backend persisting every resource in Google Cloud Datastore
+type DatastoreStorage struct{}
+
+// NewDatastoreStorage : function to create the Google Datastore storage backend
+func NewDatastoreStorage() *DatastoreStorage {
+	return &DatastoreStorage{}
+}
+
+// NewContext : Datastore calls need an App Engine context
+func (s *DatastoreStorage) NewContext(r *http.Request) context.Context {
+	return appengine.NewContext(r)
+}
+
+// Users : repository for the "users" kind
+func (s *DatastoreStorage) Users() UserRepository {
+	return datastoreUserRepository{datastoreRepository[User]{"users"}}
+}
+
+// Sessions : repository for the "sessions" kind
+func (s *DatastoreStorage) Sessions() SessionRepository {
+	return datastoreSessionRepository{datastoreRepository[Session]{"sessions"}}
+}
+
+// Campaigns : repository for the "campaigns" kind
+func (s *DatastoreStorage) Campaigns() CampaignRepository {
+	return datastoreRepository[Campaign]{"campaigns"}
+}
+
+// Invites : repository for the "invites" kind
+func (s *DatastoreStorage) Invites() InviteRepository {
+	return datastoreRepository[Invite]{"invites"}
+}
+
+// Characters : repository for the "characters" kind
+func (s *DatastoreStorage) Characters() CharacterRepository {
+	return datastoreRepository[Character]{"characters"}
+}
+
+// Drafts : repository for the "drafts" kind
+func (s *DatastoreStorage) Drafts() DraftRepository {
+	return datastoreRepository[Draft]{"drafts"}
+}
+
+// Rolls : repository for the "rolls" kind
+func (s *DatastoreStorage) Rolls() RollRepository {
+	return datastoreRepository[Roll]{"rolls"}
+}
+
+// Commitments : repository for the "commitments" kind
+func (s *DatastoreStorage) Commitments() CommitmentRepository {
+	return datastoreRepository[Commitment]{"commitments"}
+}
+
+// Scenes : repository for the "scenes" kind
+func (s *DatastoreStorage) Scenes() SceneRepository {
+	return datastoreRepository[Scene]{"scenes"}
+}
+
+// Conflicts : repository for the "conflicts" kind
+func (s *DatastoreStorage) Conflicts() ConflictRepository {
+	return datastoreRepository[Conflict]{"conflicts"}
+}
+
+// Powers : repository for the "powers" kind
+func (s *DatastoreStorage) Powers() PowerRepository {
+	return datastoreRepository[Power]{"powers"}
+}
+
+// Eidolons : repository for the "eidolons" kind
+func (s *DatastoreStorage) Eidolons() EidolonRepository {
+	return datastoreRepository[Eidolon]{"eidolons"}
+}
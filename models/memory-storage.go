@@ -0,0 +1,296 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// memoryRepository : in-memory implementation of Repository for a single kind.
+// Entities are deep-copied on the way in and out so callers never share slices with the store
+type memoryRepository[T any] struct {
+	kind     string
+	mu       sync.RWMutex
+	lastID   int64
+	entities map[string]T
+}
+
+func newMemoryRepository[T any](kind string) *memoryRepository[T] {
+	return &memoryRepository[T]{kind: kind, entities: make(map[string]T)}
+}
+
+func cloneResource[T any](resource T) (T, error) {
+	var clone T
+
+	encoded, err := json.Marshal(resource)
+	if err != nil {
+		return clone, err
+	}
+
+	err = json.Unmarshal(encoded, &clone)
+	return clone, err
+}
+
+func (m *memoryRepository[T]) checkKey(key string) error {
+	kind, _, err := decodeLocalKey(key)
+	if err != nil || kind != m.kind {
+		return ErrInvalidKey
+	}
+
+	return nil
+}
+
+func (m *memoryRepository[T]) Get(ctx context.Context, key string) (T, error) {
+	var resource T
+
+	if err := m.checkKey(key); err != nil {
+		return resource, err
+	}
+
+	m.mu.RLock()
+	stored, ok := m.entities[key]
+	m.mu.RUnlock()
+
+	if !ok {
+		return resource, ErrNotFound
+	}
+
+	return cloneResource(stored)
+}
+
+func (m *memoryRepository[T]) Create(ctx context.Context, resource T) (string, error) {
+	stampCreated(&resource)
+
+	stored, err := cloneResource(resource)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	key := encodeLocalKey(m.kind, m.lastID)
+	m.entities[key] = stored
+
+	return key, nil
+}
+
+func (m *memoryRepository[T]) Update(ctx context.Context, key string, resource *T) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.entities[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if err := bumpVersion(current, resource, VersionOf(resource)); err != nil {
+		return err
+	}
+
+	stored, err := cloneResource(*resource)
+	if err != nil {
+		return err
+	}
+
+	m.entities[key] = stored
+	return nil
+}
+
+func (m *memoryRepository[T]) Delete(ctx context.Context, key string) error {
+	if err := m.checkKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.entities, key)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// findAll : return every entity, in creation order, that satisfies match
+func (m *memoryRepository[T]) findAll(match func(T) bool) ([]Keyed[T], error) {
+	var result []Keyed[T]
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.entities))
+	for key := range m.entities {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		_, a, _ := decodeLocalKey(keys[i])
+		_, b, _ := decodeLocalKey(keys[j])
+		return a < b
+	})
+
+	for _, key := range keys {
+		if match(m.entities[key]) {
+			clone, err := cloneResource(m.entities[key])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, Keyed[T]{key, clone})
+		}
+	}
+
+	return result, nil
+}
+
+func (m *memoryRepository[T]) FindBy(ctx context.Context, field string, value interface{}) ([]Keyed[T], error) {
+	return m.findAll(func(resource T) bool { return fieldMatches(resource, field, value) })
+}
+
+func (m *memoryRepository[T]) List(ctx context.Context, query Query) (Page[T], error) {
+	resources, err := m.findAll(func(resource T) bool { return true })
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	return Paginate(resources, query)
+}
+
+// findOne : return the first entity, in creation order, that satisfies match
+func (m *memoryRepository[T]) findOne(match func(T) bool) (string, T, error) {
+	var resource T
+
+	result, err := m.findAll(match)
+	if err != nil {
+		return "", resource, err
+	}
+	if len(result) == 0 {
+		return "", resource, ErrNotFound
+	}
+
+	return result[0].Key, result[0].Resource, nil
+}
+
+type memoryUserRepository struct {
+	*memoryRepository[User]
+}
+
+func (m memoryUserRepository) FindByEmail(ctx context.Context, email string) (string, User, error) {
+	return m.findOne(func(u User) bool { return u.Email == email })
+}
+
+type memorySessionRepository struct {
+	*memoryRepository[Session]
+}
+
+func (m memorySessionRepository) FindByUser(ctx context.Context, userKey string) ([]Keyed[Session], error) {
+	return m.findAll(func(s Session) bool { return s.UserKey == userKey })
+}
+
+// MemoryStorage : storage backend keeping every resource in memory. Meant for tests and local development
+type MemoryStorage struct {
+	users       memoryUserRepository
+	sessions    memorySessionRepository
+	campaigns   *memoryRepository[Campaign]
+	invites     *memoryRepository[Invite]
+	characters  *memoryRepository[Character]
+	drafts      *memoryRepository[Draft]
+	rolls       *memoryRepository[Roll]
+	commitments *memoryRepository[Commitment]
+	scenes      *memoryRepository[Scene]
+	conflicts   *memoryRepository[Conflict]
+	powers      *memoryRepository[Power]
+	eidolons    *memoryRepository[Eidolon]
+}
+
+// NewMemoryStorage : function to create an empty in-memory storage backend
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:       memoryUserRepository{newMemoryRepository[User]("users")},
+		sessions:    memorySessionRepository{newMemoryRepository[Session]("sessions")},
+		campaigns:   newMemoryRepository[Campaign]("campaigns"),
+		invites:     newMemoryRepository[Invite]("invites"),
+		characters:  newMemoryRepository[Character]("characters"),
+		drafts:      newMemoryRepository[Draft]("drafts"),
+		rolls:       newMemoryRepository[Roll]("rolls"),
+		commitments: newMemoryRepository[Commitment]("commitments"),
+		scenes:      newMemoryRepository[Scene]("scenes"),
+		conflicts:   newMemoryRepository[Conflict]("conflicts"),
+		powers:      newMemoryRepository[Power]("powers"),
+		eidolons:    newMemoryRepository[Eidolon]("eidolons"),
+	}
+}
+
+// NewContext : the in-memory backend only needs the request's own context
+func (s *MemoryStorage) NewContext(r *http.Request) context.Context {
+	return r.Context()
+}
+
+// Users : repository for users
+func (s *MemoryStorage) Users() UserRepository {
+	return s.users
+}
+
+// Sessions : repository for login sessions
+func (s *MemoryStorage) Sessions() SessionRepository {
+	return s.sessions
+}
+
+// Campaigns : repository for campaigns
+func (s *MemoryStorage) Campaigns() CampaignRepository {
+	return s.campaigns
+}
+
+// Invites : repository for campaign invites
+func (s *MemoryStorage) Invites() InviteRepository {
+	return s.invites
+}
+
+// Characters : repository for characters
+func (s *MemoryStorage) Characters() CharacterRepository {
+	return s.characters
+}
+
+// Drafts : repository for character drafts
+func (s *MemoryStorage) Drafts() DraftRepository {
+	return s.drafts
+}
+
+// Rolls : repository for rolls
+func (s *MemoryStorage) Rolls() RollRepository {
+	return s.rolls
+}
+
+// Commitments : repository for the seeds of commit-reveal rolls
+func (s *MemoryStorage) Commitments() CommitmentRepository {
+	return s.commitments
+}
+
+// Scenes : repository for scenes
+func (s *MemoryStorage) Scenes() SceneRepository {
+	return s.scenes
+}
+
+// Conflicts : repository for conflicts
+func (s *MemoryStorage) Conflicts() ConflictRepository {
+	return s.conflicts
+}
+
+// Powers : repository for powers
+func (s *MemoryStorage) Powers() PowerRepository {
+	return s.powers
+}
+
+// Eidolons : repository for eidolons
+func (s *MemoryStorage) Eidolons() EidolonRepository {
+	return s.eidolons
+}
@@ -0,0 +1,211 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/context"
+)
+
+// Role : the part a user plays in a campaign
+type Role string
+
+// Roles a user could have in a campaign, from the most to the least privileged
+const (
+	RoleOwner     Role = "owner"
+	RoleGM        Role = "gm"
+	RoleCoGM      Role = "co-gm"
+	RolePlayer    Role = "player"
+	RoleSpectator Role = "spectator"
+	RoleNone      Role = ""
+)
+
+// IsGM : owners, GMs and co-GMs all run the game
+func (r Role) IsGM() bool {
+	return r == RoleOwner || r == RoleGM || r == RoleCoGM
+}
+
+// Action : something a requester wants to do with a resource
+type Action string
+
+// Actions checked by Authorize
+const (
+	ActionRead   Action = "read"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	// ActionManage : change the GM or the roster of a campaign
+	ActionManage Action = "manage"
+	// ActionTransfer : hand the ownership of a campaign over to someone else
+	ActionTransfer Action = "transfer"
+	// ActionAddCharacter : put a character into a campaign
+	ActionAddCharacter Action = "add characters to"
+	// ActionAddContent : put a scene or a conflict into a campaign
+	ActionAddContent Action = "add scenes or conflicts to"
+)
+
+// Requester : the authenticated user a request is made on behalf of
+type Requester struct {
+	Key       string
+	Email     string
+	Authority string
+}
+
+// RequesterOf : function to get the requester set by the authentication middleware
+func RequesterOf(r *http.Request) Requester {
+	return Requester{
+		Key:       fmt.Sprintf("%v", context.Get(r, "currentUserKey")),
+		Email:     fmt.Sprintf("%v", context.Get(r, "currentUserEmail")),
+		Authority: fmt.Sprintf("%v", context.Get(r, "currentUserAuthority")),
+	}
+}
+
+// Authorize : function to decide if a requester may perform an action on a resource.
+// Every handler goes through here so the rules live in one place:
+//   - admins could do anything
+//   - the creator of a resource could do anything with it
+//   - campaign GMs could change the characters, scenes and conflicts of their campaign
+//   - every member of a campaign, spectators included, could read what belongs to it
+//   - rolls could only be read
+func Authorize(ctx gocontext.Context, requester Requester, action Action, resource interface{}) (bool, error) {
+	if requester.Authority == utils.AdminAuthority {
+		return true, nil
+	}
+
+	switch resourceType := resource.(type) {
+	case User:
+		return resourceType.Email == requester.Email, nil
+	case Session:
+		return resourceType.UserKey == requester.Key, nil
+	case Campaign:
+		return campaignAllows(resourceType.RoleOf(requester.Key), action), nil
+	case Invite:
+		// Invites are handed out by those who manage the roster of their campaign
+		return campaignKeyAllows(ctx, requester, ActionManage, resourceType.CampaignKey)
+	case Character:
+		return campaignContentAllows(ctx, requester, action, resourceType.ParentKey, resourceType.CampaignKey)
+	case Draft:
+		// Drafts are private to their creator until finalized
+		return resourceType.ParentKey == requester.Key, nil
+	case Scene:
+		return campaignContentAllows(ctx, requester, action, resourceType.ParentKey, resourceType.CampaignKey)
+	case Conflict:
+		return campaignContentAllows(ctx, requester, action, resourceType.ParentKey, resourceType.CampaignKey)
+	case Roll:
+		// Rolls are never changed once made
+		if action != ActionRead {
+			return false, nil
+		}
+		return campaignContentAllows(ctx, requester, action, resourceType.ParentKey, resourceType.CampaignKey)
+	case Commitment:
+		return resourceType.ParentKey == requester.Key, nil
+	case Power:
+		return resourceType.ParentKey == requester.Key, nil
+	case Eidolon:
+		return resourceType.ParentKey == requester.Key, nil
+	default:
+		return false, fmt.Errorf("Unknown resource type: %v", reflect.TypeOf(resource).Name())
+	}
+}
+
+// CheckAuthorization : function to run Authorize and send the failure response when it refuses
+func CheckAuthorization(ctx gocontext.Context, action Action, resource interface{}, w http.ResponseWriter, r *http.Request) bool {
+	allowed, err := Authorize(ctx, RequesterOf(r), action, resource)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return false
+	}
+
+	if !allowed {
+		data := make(map[string]string)
+		data["Message"] = fmt.Sprintf("You are not authorized to %v this %v", action, strings.ToLower(reflect.TypeOf(resource).Name()))
+		utils.SendResponse(w, 403, data, "fail", nil)
+		return false
+	}
+
+	return true
+}
+
+// CheckCampaignAccess : function to check if the requester may perform an action on a campaign.
+// Sends the failure response and returns false otherwise
+func CheckCampaignAccess(ctx gocontext.Context, campaignKey string, action Action, w http.ResponseWriter, r *http.Request) bool {
+	campaign, err := Store.Campaigns().Get(ctx, campaignKey)
+	if err == ErrInvalidKey || err == ErrNotFound {
+		data := make(map[string]string)
+		data["CampaignKey"] = "There is no such campaign"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return false
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return false
+	}
+
+	return CheckAuthorization(ctx, action, campaign, w, r)
+}
+
+func campaignAllows(role Role, action Action) bool {
+	switch action {
+	case ActionRead:
+		return role != RoleNone
+	case ActionAddCharacter:
+		return role.IsGM() || role == RolePlayer
+	case ActionUpdate, ActionAddContent:
+		return role.IsGM()
+	case ActionManage, ActionDelete:
+		return role == RoleOwner || role == RoleGM
+	case ActionTransfer:
+		return role == RoleOwner
+	default:
+		return false
+	}
+}
+
+// campaignKeyAllows : campaignAllows for a campaign that has yet to be loaded
+func campaignKeyAllows(ctx gocontext.Context, requester Requester, action Action, campaignKey string) (bool, error) {
+	campaign, err := Store.Campaigns().Get(ctx, campaignKey)
+	if err == ErrNotFound || err == ErrInvalidKey {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return campaignAllows(campaign.RoleOf(requester.Key), action), nil
+}
+
+// campaignContentAllows : rules shared by characters, scenes and conflicts
+func campaignContentAllows(ctx gocontext.Context, requester Requester, action Action, parentKey string, campaignKey string) (bool, error) {
+	if parentKey == requester.Key {
+		return true, nil
+	}
+	if campaignKey == "" {
+		return false, nil
+	}
+
+	campaign, err := Store.Campaigns().Get(ctx, campaignKey)
+	if err == ErrNotFound || err == ErrInvalidKey {
+		// The campaign is gone so only the creator is left
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	role := campaign.RoleOf(requester.Key)
+	if action == ActionRead {
+		return role != RoleNone, nil
+	}
+
+	// Players may only change their own characters
+	return role.IsGM(), nil
+}
@@ -0,0 +1,236 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor : returned by a repository when the given cursor cannot be decoded by the backend
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// ErrUnsortable : returned by a repository when the backend has no index to sort the listing that way
+var ErrUnsortable = errors.New("This listing could not be sorted by this field along with these filters")
+
+// DefaultPageSize : how many resources a page holds when the client doesn't say
+const DefaultPageSize = 20
+
+// MaxPageSize : the most resources a client could ask for in a single page
+const MaxPageSize = 100
+
+// Filter : an equality condition on a field. For slice fields, any element may match
+type Filter struct {
+	Field string
+	Value interface{}
+}
+
+// Query : which resources to list, in which order and from where
+type Query struct {
+	Filters    []Filter
+	Sort       string
+	Descending bool
+	Limit      int
+	// Cursor : opaque position returned as NextCursor by the previous page
+	Cursor string
+}
+
+// Page : a slice of a listing along with the cursor to the next one, empty on the last page
+type Page[T any] struct {
+	Items      []Keyed[T]
+	NextCursor string
+}
+
+// ParseQuery : function to build a Query for resources of type T out of URL query parameters.
+// "limit", "cursor" and "sort" ("Name" or "-Name" for descending) are reserved. Every other parameter
+// names a field to filter by, e.g. "?IsResolved=false&Type=attack". Like CheckArgs, it returns the
+// offending parameters along with what's wrong with them
+func ParseQuery[T any](values url.Values) (Query, map[string]string) {
+	var resource T
+	resourceType := reflect.TypeOf(resource)
+	query := Query{Limit: DefaultPageSize}
+	invalidArgs := make(map[string]string)
+
+	for param, raws := range values {
+		raw := raws[0]
+
+		switch param {
+		case "limit":
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > MaxPageSize {
+				invalidArgs[param] = "This argument must be a number between 1 and " + strconv.Itoa(MaxPageSize)
+				continue
+			}
+			query.Limit = limit
+		case "cursor":
+			query.Cursor = raw
+		case "sort":
+			query.Sort = strings.TrimPrefix(raw, "-")
+			query.Descending = strings.HasPrefix(raw, "-")
+
+			field, ok := resourceType.FieldByName(query.Sort)
+			if !ok || !isSortable(field.Type) {
+				invalidArgs[param] = "There is no such field to sort by"
+			}
+		default:
+			fieldType, ok := fieldTypeOf(resourceType, strings.Split(param, "."))
+			if !ok {
+				invalidArgs[param] = "There is no such field to filter by"
+				continue
+			}
+
+			for _, raw := range raws {
+				value, err := parseFieldValue(fieldType, raw)
+				if err != nil {
+					invalidArgs[param] = "This argument must be a " + fieldType.Kind().String()
+					break
+				}
+				query.Filters = append(query.Filters, Filter{param, value})
+			}
+		}
+	}
+
+	if len(invalidArgs) > 0 {
+		return query, invalidArgs
+	}
+
+	return query, nil
+}
+
+// Paginate : function to filter, sort and slice resources already loaded in memory.
+// Used by the backends that can't query by property and by listings merging several queries
+func Paginate[T any](resources []Keyed[T], query Query) (Page[T], error) {
+	var page Page[T]
+
+	offset := 0
+	if query.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil || !strings.HasPrefix(string(decoded), "offset:") {
+			return page, ErrInvalidCursor
+		}
+
+		offset, err = strconv.Atoi(strings.TrimPrefix(string(decoded), "offset:"))
+		if err != nil || offset < 0 {
+			return page, ErrInvalidCursor
+		}
+	}
+
+	matched := make([]Keyed[T], 0, len(resources))
+	for _, resource := range resources {
+		if matchesFilters(resource.Resource, query.Filters) {
+			matched = append(matched, resource)
+		}
+	}
+
+	if query.Sort != "" {
+		// Keep the incoming order between equal values so pages stay stable
+		sort.SliceStable(matched, func(i, j int) bool {
+			a := reflect.ValueOf(matched[i].Resource).FieldByName(query.Sort)
+			b := reflect.ValueOf(matched[j].Resource).FieldByName(query.Sort)
+			if query.Descending {
+				return lessValue(b, a)
+			}
+			return lessValue(a, b)
+		})
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := offset + limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	page.Items = matched[offset:end]
+	if end < len(matched) {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(end)))
+	}
+
+	return page, nil
+}
+
+func matchesFilters(resource interface{}, filters []Filter) bool {
+	for _, filter := range filters {
+		if !fieldMatches(resource, filter.Field, filter.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fieldTypeOf : the type of a field, following dotted names into nested structs and slices of them.
+// Slices of plain values are filtered by their elements so their element type is returned
+func fieldTypeOf(t reflect.Type, path []string) (reflect.Type, bool) {
+	for t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	if len(path) == 0 {
+		return t, true
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	field, ok := t.FieldByName(path[0])
+	if !ok || field.PkgPath != "" {
+		return nil, false
+	}
+
+	return fieldTypeOf(field.Type, path[1:])
+}
+
+// parseFieldValue : convert a query parameter into the type of the field it filters.
+// Integers are converted to int64 as that's how Datastore stores them
+func parseFieldValue(t reflect.Type, raw string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(raw).Convert(t).Interface(), nil
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	default:
+		return nil, errors.New("Unsupported field type")
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func isSortable(t reflect.Type) bool {
+	return t == timeType || isNumeric(t.Kind()) || t.Kind() == reflect.String || t.Kind() == reflect.Bool
+}
+
+func lessValue(a reflect.Value, b reflect.Value) bool {
+	switch {
+	case a.Type() == timeType:
+		return a.Interface().(time.Time).Before(b.Interface().(time.Time))
+	case isNumeric(a.Kind()):
+		return toFloat(a) < toFloat(b)
+	case a.Kind() == reflect.String:
+		return a.String() < b.String()
+	case a.Kind() == reflect.Bool:
+		return !a.Bool() && b.Bool()
+	default:
+		return false
+	}
+}
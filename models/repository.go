@@ -0,0 +1,250 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound : returned by a repository when there is no entity with the given key
+var ErrNotFound = errors.New("There is no such resource")
+
+// ErrInvalidKey : returned by a repository when the given key cannot be decoded by the backend
+var ErrInvalidKey = errors.New("Invalid resource key")
+
+// Store : storage backend used by every handler. It must be set before the server starts accepting requests
+var Store Storage
+
+// Repository : basic storage operations shared by every resource.
+// Keys are opaque strings produced by the backend and are safe to use in URLs.
+// Entities are created at version 1, see VersionOf
+type Repository[T any] interface {
+	Get(ctx context.Context, key string) (T, error)
+	Create(ctx context.Context, resource T) (string, error)
+	// Update : replace an entity as long as it's still at the version resource was read at, and bump the version of resource.
+	// Returns ErrVersionConflict when someone else has updated it in the meantime
+	Update(ctx context.Context, key string, resource *T) error
+	Delete(ctx context.Context, key string) error
+	// FindBy : return every entity whose field equals value. For slice fields, any element may match.
+	// Fields of nested structs are named with dots, e.g. "Bonus.UserID"
+	FindBy(ctx context.Context, field string, value interface{}) ([]Keyed[T], error)
+	// List : return a page of the entities matching every filter of the query
+	List(ctx context.Context, query Query) (Page[T], error)
+}
+
+// Keyed : a resource along with the key it is stored under
+type Keyed[T any] struct {
+	Key      string
+	Resource T
+}
+
+// UserRepository : storage operations for users
+type UserRepository interface {
+	Repository[User]
+	FindByEmail(ctx context.Context, email string) (string, User, error)
+}
+
+// SessionRepository : storage operations for login sessions
+type SessionRepository interface {
+	Repository[Session]
+	FindByUser(ctx context.Context, userKey string) ([]Keyed[Session], error)
+}
+
+// CampaignRepository : storage operations for campaigns
+type CampaignRepository interface {
+	Repository[Campaign]
+}
+
+// InviteRepository : storage operations for campaign invites
+type InviteRepository interface {
+	Repository[Invite]
+}
+
+// CharacterRepository : storage operations for characters
+type CharacterRepository interface {
+	Repository[Character]
+}
+
+// DraftRepository : storage operations for character drafts
+type DraftRepository interface {
+	Repository[Draft]
+}
+
+// RollRepository : storage operations for rolls
+type RollRepository interface {
+	Repository[Roll]
+}
+
+// CommitmentRepository : storage operations for the seeds of commit-reveal rolls
+type CommitmentRepository interface {
+	Repository[Commitment]
+}
+
+// SceneRepository : storage operations for scenes
+type SceneRepository interface {
+	Repository[Scene]
+}
+
+// ConflictRepository : storage operations for conflicts
+type ConflictRepository interface {
+	Repository[Conflict]
+}
+
+// PowerRepository : storage operations for powers
+type PowerRepository interface {
+	Repository[Power]
+}
+
+// EidolonRepository : storage operations for eidolons
+type EidolonRepository interface {
+	Repository[Eidolon]
+}
+
+// Storage : a storage backend holding one repository per resource
+type Storage interface {
+	// NewContext : derive the context the repositories expect from an incoming request
+	NewContext(r *http.Request) context.Context
+	Users() UserRepository
+	Sessions() SessionRepository
+	Campaigns() CampaignRepository
+	Invites() InviteRepository
+	Characters() CharacterRepository
+	Drafts() DraftRepository
+	Rolls() RollRepository
+	Commitments() CommitmentRepository
+	Scenes() SceneRepository
+	Conflicts() ConflictRepository
+	Powers() PowerRepository
+	Eidolons() EidolonRepository
+}
+
+// NewStorage : function to create a storage backend by its name.
+// path is only used by backends that persist to a local file
+func NewStorage(name string, path string) (Storage, error) {
+	switch name {
+	case "", "datastore":
+		return NewDatastoreStorage(), nil
+	case "memory":
+		return NewMemoryStorage(), nil
+	case "bolt":
+		store, err := NewBoltStorage(path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("Unknown storage backend: %v", name)
+	}
+}
+
+// NewContext : shorthand for Store.NewContext
+func NewContext(r *http.Request) context.Context {
+	return Store.NewContext(r)
+}
+
+// encodeLocalKey : build an opaque, URL-safe key out of a kind and a numeric ID.
+// Used by the backends that don't have their own key format
+func encodeLocalKey(kind string, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + ":" + strconv.FormatInt(id, 10)))
+}
+
+// decodeLocalKey : reverse of encodeLocalKey
+func decodeLocalKey(key string) (string, int64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return "", 0, ErrInvalidKey
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", 0, ErrInvalidKey
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidKey
+	}
+
+	return parts[0], id, nil
+}
+
+// fieldMatches : check if a struct's field equals value, mimicking Datastore's equality filter.
+// Like Datastore, fields of nested structs are named with dots, e.g. "Bonus.UserID".
+// Used by the backends that can't query by property
+func fieldMatches(resource interface{}, field string, value interface{}) bool {
+	return pathMatches(reflect.ValueOf(resource), strings.Split(field, "."), value)
+}
+
+func pathMatches(v reflect.Value, path []string, value interface{}) bool {
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			if pathMatches(v.Index(i), path, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return valueEquals(v, value)
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	f := v.FieldByName(path[0])
+	if !f.IsValid() {
+		return false
+	}
+
+	return pathMatches(f, path[1:], value)
+}
+
+func valueEquals(v reflect.Value, value interface{}) bool {
+	other := reflect.ValueOf(value)
+	if !other.IsValid() {
+		return false
+	}
+
+	// Numbers decoded from JSON arrive as float64 so compare every numeric kind by value
+	if isNumeric(v.Kind()) && isNumeric(other.Kind()) {
+		return toFloat(v) == toFloat(other)
+	}
+	if v.Type() != other.Type() {
+		return false
+	}
+
+	return reflect.DeepEqual(v.Interface(), other.Interface())
+}
+
+func isNumeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
@@ -0,0 +1,54 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+// BaseDice : how many dice every skill roll starts with, before any bonus die
+const BaseDice = 2
+
+// Where the dice of a roll come from
+const (
+	SourceBase       = "base"
+	SourceTrait      = "trait"
+	SourceSceneBonus = "sceneBonus"
+	SourceCharge     = "charge"
+)
+
+// SuccessThreshold : the lowest value a die needs to show to count as a success for a skill rating.
+// The better the skill, the lower the threshold, although a 1 never succeeds and a 6 always does
+func SuccessThreshold(rating int) int {
+	threshold := 6 - rating
+	if threshold < 2 {
+		return 2
+	}
+	if threshold > 6 {
+		return 6
+	}
+
+	return threshold
+}
+
+// NewRoll : give each die of a pool its value and count the successes against the threshold of a skill.
+// values holds one die value per die of the pool
+func NewRoll(skill Skill, pool []RolledDie, values []int) Roll {
+	roll := Roll{
+		SkillID:   skill.ID,
+		Rating:    skill.Rating,
+		Threshold: SuccessThreshold(skill.Rating),
+		Dice:      make([]RolledDie, len(pool)),
+	}
+
+	for i, die := range pool {
+		die.Value = values[i]
+		die.IsSuccess = die.Value >= roll.Threshold
+		if die.IsSuccess {
+			roll.Successes++
+		}
+		roll.Dice[i] = die
+	}
+
+	return roll
+}
@@ -0,0 +1,222 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rules : the character creation rules of a campaign.
+// Stored within the campaign so only plain fields and slices of structs are allowed
+type Rules struct {
+	// Traits : how many traits a character has
+	Traits int
+	// Skills : how many skills a character has at each rating. No other rating is allowed
+	Skills []SkillSlot
+	// Powers : how many powers a character starts with
+	Powers int
+	// Links : how many links to other characters a character needs at least
+	Links int
+}
+
+// SkillSlot : how many skills a character has at a given rating
+type SkillSlot struct {
+	Rating int
+	Count  int
+}
+
+// Violation : a character creation rule a character breaks, along with the field breaking it and a code clients could act on
+type Violation struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// DefaultRules : the rules characters follow unless their campaign has house rules
+func DefaultRules() Rules {
+	return Rules{
+		Traits: 3,
+		Skills: []SkillSlot{
+			{Rating: 3, Count: 1},
+			{Rating: 2, Count: 2},
+			{Rating: 1, Count: 3},
+		},
+		Powers: 3,
+		Links:  1,
+	}
+}
+
+// CharacterRules : the rules the characters of this campaign follow
+func (c Campaign) CharacterRules() Rules {
+	if c.HasHouseRules {
+		return c.HouseRules
+	}
+
+	return DefaultRules()
+}
+
+// RulesFor : the rules a character follows, those of its campaign or the default ones outside of any campaign.
+// A character could only be linked to the other characters of its campaign so fewer links are required while there aren't enough of them
+func RulesFor(ctx context.Context, key string, character Character) (Rules, error) {
+	rules := DefaultRules()
+	if character.CampaignKey == "" {
+		rules.Links = 0
+		return rules, nil
+	}
+
+	campaign, err := Store.Campaigns().Get(ctx, character.CampaignKey)
+	if err != nil && err != ErrNotFound && err != ErrInvalidKey {
+		return Rules{}, err
+	}
+	if err == nil {
+		rules = campaign.CharacterRules()
+	}
+
+	party, err2 := Store.Characters().FindBy(ctx, "CampaignKey", character.CampaignKey)
+	if err2 != nil {
+		return Rules{}, err2
+	}
+
+	others := 0
+	for _, member := range party {
+		if member.Key != key {
+			others++
+		}
+	}
+	if others < rules.Links {
+		rules.Links = others
+	}
+
+	return rules, nil
+}
+
+// Check : every rule a character breaks. Empty when the character is fine
+func (rules Rules) Check(character Character) []Violation {
+	violations := []Violation{}
+
+	if len(character.Traits) != rules.Traits {
+		violations = append(violations, Violation{
+			Field:   "Traits",
+			Code:    "traitCount",
+			Message: fmt.Sprintf("A character must have %v, not %v", plural(rules.Traits, "trait"), len(character.Traits)),
+		})
+	}
+
+	allowed := make(map[int]bool)
+	for _, slot := range rules.Skills {
+		allowed[slot.Rating] = true
+	}
+
+	counts := make(map[int]int)
+	seen := make(map[string]bool)
+	for i, skill := range character.Skills {
+		if seen[skill.ID] {
+			violations = append(violations, Violation{
+				Field:   fmt.Sprintf("Skills.%v.ID", i),
+				Code:    "duplicate",
+				Message: "This skill is already listed",
+			})
+		}
+		seen[skill.ID] = true
+
+		if !allowed[skill.Rating] {
+			violations = append(violations, Violation{
+				Field:   fmt.Sprintf("Skills.%v.Rating", i),
+				Code:    "rating",
+				Message: fmt.Sprintf("Skills could only be rated %v", rules.ratings()),
+			})
+			continue
+		}
+		counts[skill.Rating]++
+	}
+
+	for _, slot := range rules.Skills {
+		if counts[slot.Rating] != slot.Count {
+			violations = append(violations, Violation{
+				Field:   "Skills",
+				Code:    "skillCount",
+				Message: fmt.Sprintf("A character must have %v but this one has %v", rules.describeSkills(nil), rules.describeSkills(counts)),
+			})
+			break
+		}
+	}
+
+	if len(character.Powers) != rules.Powers {
+		violations = append(violations, Violation{
+			Field:   "Powers",
+			Code:    "powerCount",
+			Message: fmt.Sprintf("A character must start with %v, not %v", plural(rules.Powers, "power"), len(character.Powers)),
+		})
+	}
+
+	if len(character.Links) < rules.Links {
+		violations = append(violations, Violation{
+			Field:   "Links",
+			Code:    "linkCount",
+			Message: fmt.Sprintf("A character must be linked to at least %v", plural(rules.Links, "other character")),
+		})
+	}
+
+	return violations
+}
+
+// sortedSkills : the skill slots from the highest rating down
+func (rules Rules) sortedSkills() []SkillSlot {
+	slots := append([]SkillSlot(nil), rules.Skills...)
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Rating > slots[j].Rating })
+	return slots
+}
+
+// ratings : the allowed skill ratings, e.g. "3, 2 or 1"
+func (rules Rules) ratings() string {
+	var ratings []string
+	for _, slot := range rules.sortedSkills() {
+		ratings = append(ratings, fmt.Sprint(slot.Rating))
+	}
+
+	return joinWords(ratings, "or")
+}
+
+// describeSkills : how many skills there are at each rating, e.g. "1 skill at rating 3 and 2 skills at rating 2".
+// Uses the counts of the rules when counts is nil
+func (rules Rules) describeSkills(counts map[int]int) string {
+	var parts []string
+	for _, slot := range rules.sortedSkills() {
+		count := slot.Count
+		if counts != nil {
+			count = counts[slot.Rating]
+		}
+		parts = append(parts, fmt.Sprintf("%v at rating %v", plural(count, "skill"), slot.Rating))
+	}
+
+	if len(parts) == 0 {
+		return "no skill"
+	}
+
+	return joinWords(parts, "and")
+}
+
+// plural : a count along with a noun, e.g. "1 trait" or "3 traits"
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%v %v", count, noun)
+	}
+
+	return fmt.Sprintf("%v %vs", count, noun)
+}
+
+// joinWords : join words the way a sentence would, e.g. "a, b and c"
+func joinWords(words []string, conjunction string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+
+	return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+}
@@ -0,0 +1,96 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package models
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+// ErrVersionConflict : returned by Update when the entity has been updated by someone else since it was read
+var ErrVersionConflict = errors.New("The resource has been modified by someone else")
+
+// VersionOf : the version of a resource. Every entity starts at 1 and every update bumps it,
+// so two clients editing the same entity can't silently overwrite each other
+func VersionOf(resource interface{}) int64 {
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+
+	f := v.FieldByName("Version")
+	if !f.IsValid() || !f.CanInt() {
+		return 0
+	}
+
+	return f.Int()
+}
+
+// ModifiedAtOf : when a resource was last created or updated. Zero for resources without a ModifiedAt field
+func ModifiedAtOf(resource interface{}) time.Time {
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	if v.Kind() != reflect.Struct {
+		return time.Time{}
+	}
+
+	f := v.FieldByName("ModifiedAt")
+	if !f.IsValid() {
+		return time.Time{}
+	}
+
+	modifiedAt, _ := f.Interface().(time.Time)
+	return modifiedAt
+}
+
+// setVersion : set the version of the resource a pointer points to
+func setVersion(resource interface{}, version int64) {
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	f := v.FieldByName("Version")
+	if f.IsValid() && f.CanSet() && f.CanInt() {
+		f.SetInt(version)
+	}
+}
+
+// setTime : set a time field of the resource a pointer points to, if it has one
+func setTime(resource interface{}, field string, t time.Time) {
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	f := v.FieldByName(field)
+	if f.IsValid() && f.CanSet() && f.Type() == reflect.TypeOf(t) {
+		f.Set(reflect.ValueOf(t))
+	}
+}
+
+// stampCreated : start a new entity at version 1, created and modified now. Used by every backend's Create
+func stampCreated(resource interface{}) {
+	now := time.Now()
+
+	setVersion(resource, 1)
+	setTime(resource, "CreatedAt", now)
+	setTime(resource, "ModifiedAt", now)
+}
+
+// bumpVersion : check the stored entity is still at the version the update was based on,
+// then bump the version of resource and mark it modified now.
+// expected is taken before the update starts so a transaction retried by the backend checks against the same version
+func bumpVersion(current interface{}, resource interface{}, expected int64) error {
+	if VersionOf(current) != expected {
+		return ErrVersionConflict
+	}
+
+	setVersion(resource, expected+1)
+	setTime(resource, "ModifiedAt", time.Now())
+	return nil
+}
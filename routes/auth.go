@@ -7,23 +7,23 @@
 package routes
 
 import (
+	gocontext "context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/context"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // AuthenticateUser : endpoint to refresh access token and refresh token with login.
 func AuthenticateUser(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+	ctx := models.NewContext(r)
 	loginData := make(map[string]interface{})
-	var user models.User
-	var key *datastore.Key
-	var err2 error
 	requiredArgs := map[string]string{
 		"Password": "required",
 		"Email":    "required",
@@ -44,47 +44,32 @@ func AuthenticateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Lookup the email
-	q := datastore.NewQuery("users").Filter("Email =", loginData["Email"])
-	t := q.Run(ctx)
-
-	for {
-		key, err2 = t.Next(&user)
-		if err2 == datastore.Done {
-			data := make(map[string]string)
-			data["Message"] = "Wrong password or email"
-			utils.SendResponse(w, 401, data, "fail", nil)
-			return
-		}
-		if err2 != nil {
-			utils.SendResponse(w, 500, err2.Error(), "error", nil)
-			return
-		}
-
-		if checkPasswordHash(loginData["Password"].(string), user.Hash) {
-			// Proceed to generate the access token and refresh token
-			break
-		} else {
-			data := make(map[string]string)
-			data["Message"] = "Wrong password or email"
-			utils.SendResponse(w, 401, data, "fail", nil)
-			return
-		}
+	key, user, err2 := models.Store.Users().FindByEmail(ctx, fmt.Sprintf("%v", loginData["Email"]))
+	if err2 != nil && err2 != models.ErrNotFound {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
 	}
 
-	// Generate the access token and refresh token
-	accessToken := utils.GenerateAccessToken(key)
-	refreshToken := utils.RandSeq(20)
-
-	// Update the user data because refresh token is stored in datastore
-	user.RefreshToken = refreshToken
+	if err2 == models.ErrNotFound || !checkPasswordHash(fmt.Sprintf("%v", loginData["Password"]), user.Hash) {
+		data := make(map[string]string)
+		data["Message"] = "Wrong password or email"
+		utils.SendResponse(w, 401, data, "fail", nil)
+		return
+	}
 
-	// Commit to to server
-	_, err3 := datastore.Put(ctx, key, &user)
+	// Start a new session for this device and generate its tokens
+	sessionKey, refreshToken, err3 := startSession(ctx, key, deviceName(loginData["Device"], r))
 	if err3 != nil {
 		utils.SendResponse(w, 500, err3.Error(), "error", nil)
 		return
 	}
 
+	accessToken, err4 := utils.GenerateAccessToken(key, sessionKey, user.TokenVersion)
+	if err4 != nil {
+		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		return
+	}
+
 	response := map[string]string{
 		"AccessToken":  accessToken,
 		"RefreshToken": refreshToken,
@@ -94,56 +79,160 @@ func AuthenticateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // RefreshAccessToken : endpoint to refresh access token and refresh token without login.
+// The refresh token is rotated on every call. Presenting a refresh token that was already rotated
+// means it has been leaked, so the whole session is revoked
 func RefreshAccessToken(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	var key *datastore.Key
-	var err error
-	ctx := appengine.NewContext(r)
-
-	// Lookup the refresh token
-	q := datastore.NewQuery("users").Filter("RefreshToken =", r.Header.Get("anima-prime-refresh-token"))
-	t := q.Run(ctx)
-
-	for {
-		key, err = t.Next(&user)
-		if err == datastore.Done {
+	ctx := models.NewContext(r)
+
+	// Lookup the session the refresh token belongs to
+	sessionKey, secret := splitRefreshToken(r.Header.Get("anima-prime-refresh-token"))
+	session, err := models.Store.Sessions().Get(ctx, sessionKey)
+	if err == models.ErrInvalidKey || err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "There is no such refresh token"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	hash := utils.HashToken(secret)
+	if hash != session.TokenHash {
+		if !utils.Contains(session.RotatedHashes, hash) {
 			data := make(map[string]string)
 			data["Message"] = "There is no such refresh token"
 			utils.SendResponse(w, 404, data, "fail", nil)
 			return
 		}
-		if err != nil {
-			utils.SendResponse(w, 500, err.Error(), "error", nil)
+
+		// This refresh token has already been rotated. Either the client or an attacker is replaying it
+		// so revoke every refresh token of this session
+		err2 := models.Store.Sessions().Delete(ctx, sessionKey)
+		if err2 != nil {
+			utils.SendResponse(w, 500, err2.Error(), "error", nil)
 			return
 		}
 
-		// Proceed
-		break
+		data := make(map[string]string)
+		data["Message"] = "This refresh token has already been used. Please login again"
+		utils.SendResponse(w, 401, data, "fail", nil)
+		return
 	}
 
-	// Generate the access token and refresh token
-	accessToken := utils.GenerateAccessToken(key)
-	refreshToken := utils.RandSeq(20)
+	// Generate the access token and rotate the refresh token
+	user, err6 := models.Store.Users().Get(ctx, session.UserKey)
+	if err6 == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "There is no such refresh token"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+	if err6 != nil {
+		utils.SendResponse(w, 500, err6.Error(), "error", nil)
+		return
+	}
 
-	// Update the user data because refresh token is stored in datastore
-	user.RefreshToken = refreshToken
+	accessToken, err4 := utils.GenerateAccessToken(session.UserKey, sessionKey, user.TokenVersion)
+	if err4 != nil {
+		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		return
+	}
+
+	newSecret, err5 := utils.RandomToken(32)
+	if err5 != nil {
+		utils.SendResponse(w, 500, err5.Error(), "error", nil)
+		return
+	}
+
+	session.RotatedHashes = append(session.RotatedHashes, session.TokenHash)
+	if len(session.RotatedHashes) > maxRotatedHashes {
+		session.RotatedHashes = session.RotatedHashes[len(session.RotatedHashes)-maxRotatedHashes:]
+	}
+	session.TokenHash = utils.HashToken(newSecret)
+	session.LastUsedAt = time.Now()
 
 	// Commit to to server
-	_, err3 := datastore.Put(ctx, key, &user)
+	err3 := models.Store.Sessions().Update(ctx, sessionKey, &session)
 	if err3 != nil {
-		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		sendUpdateError(err3, w, r)
 		return
 	}
 
 	response := map[string]string{
 		"AccessToken":  accessToken,
-		"RefreshToken": refreshToken,
+		"RefreshToken": sessionKey + "." + newSecret,
 	}
 
 	utils.SendResponse(w, 200, response, "success", nil)
 }
 
+// Logout : endpoint to revoke the session of the current access token, along with its refresh token
+func Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	sessionKey := fmt.Sprintf("%v", context.Get(r, "currentSessionKey"))
+
+	err := models.Store.Sessions().Delete(ctx, sessionKey)
+	if err != nil && err != models.ErrInvalidKey {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", nil)
+}
+
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// maxRotatedHashes : how many rotated refresh tokens a session remembers to detect replays
+const maxRotatedHashes = 50
+
+// startSession : create a new session for a user and return its key and first refresh token.
+// A refresh token is made of the session key and a secret. Only the hash of the secret is stored
+func startSession(ctx gocontext.Context, userKey string, device string) (string, string, error) {
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserKey:    userKey,
+		Device:     device,
+		TokenHash:  utils.HashToken(secret),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
+	sessionKey, err := models.Store.Sessions().Create(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sessionKey, sessionKey + "." + secret, nil
+}
+
+// splitRefreshToken : split a refresh token into its session key and secret
+func splitRefreshToken(refreshToken string) (string, string) {
+	i := strings.LastIndex(refreshToken, ".")
+	if i < 0 {
+		return refreshToken, ""
+	}
+
+	return refreshToken[:i], refreshToken[i+1:]
+}
+
+// deviceName : name a session after the device the client reports, or its user agent otherwise
+func deviceName(device interface{}, r *http.Request) string {
+	if device != nil && fmt.Sprintf("%v", device) != "" {
+		return fmt.Sprintf("%v", device)
+	}
+
+	return r.UserAgent()
+}
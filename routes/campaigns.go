@@ -0,0 +1,232 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	gocontext "context"
+	"net/http"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/mux"
+)
+
+// campaigns : a campaign belongs to its owner and is run by its GM for a roster of players
+var campaigns = resource[models.Campaign]{
+	name:       "campaigns",
+	keyParam:   "campaignKey",
+	repository: func() models.Repository[models.Campaign] { return models.Store.Campaigns() },
+	createArgs: map[string]string{
+		"Name":        "required",
+		"Description": "optional",
+	},
+	updateArgs: map[string]string{
+		"Name":        "optional",
+		"Description": "optional",
+		"GMKey":       "optional",
+		"CoGMs":       "optional",
+		"Players":     "optional",
+		"Spectators":  "optional",
+		"ParentKey":   "optional",
+	},
+	// The requester becomes the GM of the campaign they create
+	defaults: func(campaignMap map[string]interface{}, r *http.Request) {
+		campaignMap["GMKey"] = models.RequesterOf(r).Key
+		campaignMap["Players"] = []string{}
+		setParentKey(campaignMap, r)
+	},
+	// Co-GMs could change the details of a campaign while only the owner and the GM could change who plays which role.
+	// Only the owner could hand the campaign over
+	updateAction: func(campaignMap map[string]interface{}) models.Action {
+		if _, ok := campaignMap["ParentKey"]; ok {
+			return models.ActionTransfer
+		}
+		for _, field := range []string{"GMKey", "CoGMs", "Players", "Spectators"} {
+			if _, ok := campaignMap[field]; ok {
+				return models.ActionManage
+			}
+		}
+		return models.ActionUpdate
+	},
+	validate: func(ctx gocontext.Context, key string, campaign models.Campaign) fieldErrors {
+		if campaign.GMKey == "" || campaign.ParentKey == "" {
+			return fieldErrors{"GMKey": {Code: "required", Message: "A campaign must always have an owner and a GM"}}
+		}
+		return nil
+	},
+	// House rules are only shown when they're followed. GET /campaigns/{campaignKey}/rules gives the rules in force either way
+	present: func(key string, campaign models.Campaign) (map[string]interface{}, error) {
+		data, err := resourceData(key, campaign)
+		if err != nil {
+			return nil, err
+		}
+
+		if !campaign.HasHouseRules {
+			delete(data, "HouseRules")
+		}
+
+		return data, nil
+	},
+	// Its characters, drafts, scenes and conflicts are kept but leave the campaign
+	beforeDelete: func(ctx gocontext.Context, key string, campaign models.Campaign) error {
+		return detachFromCampaign(ctx, key)
+	},
+}
+
+// CreateCampaigns : endpoint to create a new campaign. The requester becomes its GM
+func CreateCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns.create(w, r)
+}
+
+// GetCampaigns : endpoint to retrieve a campaign
+// Only its members could retrieve it unless they're the admin
+func GetCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns.get(w, r)
+}
+
+// ListCampaigns : endpoint to list the campaigns the requester takes part in, whatever their role
+func ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	currentUserKey := models.RequesterOf(r).Key
+
+	query, invalidArgs := models.ParseQuery[models.Campaign](r.URL.Query())
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	// Look the requester up in every role, skipping the campaigns already listed under a higher role
+	var joined []models.Keyed[models.Campaign]
+	listed := make(map[string]bool)
+
+	for _, field := range []string{"ParentKey", "GMKey", "CoGMs", "Players", "Spectators"} {
+		found, err := models.Store.Campaigns().FindBy(ctx, field, currentUserKey)
+		if err != nil {
+			utils.SendResponse(w, 500, err.Error(), "error", nil)
+			return
+		}
+
+		for _, campaign := range found {
+			if !listed[campaign.Key] {
+				listed[campaign.Key] = true
+				joined = append(joined, campaign)
+			}
+		}
+	}
+
+	// The campaigns are merged out of several queries so they're paged in memory
+	page, err2 := models.Paginate(joined, query)
+	page, ok := checkPage(page, err2, w)
+	if !ok {
+		return
+	}
+
+	campaigns.sendPage(page, w, r)
+}
+
+// UpdateCampaigns : endpoint to update a campaign. Co-GMs could change its details
+// while only the owner and the GM could change who plays which role
+func UpdateCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns.update(w, r)
+}
+
+// PatchCampaigns : endpoint to partially update a campaign with a JSON Merge Patch or a JSON Patch
+func PatchCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns.patch(w, r)
+}
+
+// DeleteCampaigns : endpoint to delete a campaign. Its characters, drafts, scenes and conflicts are kept but leave the campaign
+func DeleteCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns.delete(w, r)
+}
+
+// ListCampaignCharacters : endpoint to list the characters of a campaign
+func ListCampaignCharacters(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if _, ok := campaigns.load(params["campaignKey"], models.ActionRead, w, r); !ok {
+		return
+	}
+
+	characters.listWhere(inCampaign(params["campaignKey"]), w, r)
+}
+
+// ListCampaignScenes : endpoint to list the scenes of a campaign
+func ListCampaignScenes(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if _, ok := campaigns.load(params["campaignKey"], models.ActionRead, w, r); !ok {
+		return
+	}
+
+	scenes.listWhere(inCampaign(params["campaignKey"]), w, r)
+}
+
+// ListCampaignConflicts : endpoint to list the conflicts of a campaign
+func ListCampaignConflicts(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if _, ok := campaigns.load(params["campaignKey"], models.ActionRead, w, r); !ok {
+		return
+	}
+
+	conflicts.listWhere(inCampaign(params["campaignKey"]), w, r)
+}
+
+// inCampaign : filter restricting a listing to what belongs to a campaign
+func inCampaign(campaignKey string) []models.Filter {
+	return []models.Filter{{Field: "CampaignKey", Value: campaignKey}}
+}
+
+// detachFromCampaign : remove every character, draft, scene and conflict from a campaign
+func detachFromCampaign(ctx gocontext.Context, campaignKey string) error {
+	attachedCharacters, err := models.Store.Characters().FindBy(ctx, "CampaignKey", campaignKey)
+	if err != nil {
+		return err
+	}
+	for _, character := range attachedCharacters {
+		character.Resource.CampaignKey = ""
+		if err := models.Store.Characters().Update(ctx, character.Key, &character.Resource); err != nil {
+			return err
+		}
+	}
+
+	attachedDrafts, err := models.Store.Drafts().FindBy(ctx, "CampaignKey", campaignKey)
+	if err != nil {
+		return err
+	}
+	for _, draft := range attachedDrafts {
+		draft.Resource.CampaignKey = ""
+		if err := models.Store.Drafts().Update(ctx, draft.Key, &draft.Resource); err != nil {
+			return err
+		}
+	}
+
+	attachedScenes, err := models.Store.Scenes().FindBy(ctx, "CampaignKey", campaignKey)
+	if err != nil {
+		return err
+	}
+	for _, scene := range attachedScenes {
+		scene.Resource.CampaignKey = ""
+		if err := models.Store.Scenes().Update(ctx, scene.Key, &scene.Resource); err != nil {
+			return err
+		}
+	}
+
+	attachedConflicts, err := models.Store.Conflicts().FindBy(ctx, "CampaignKey", campaignKey)
+	if err != nil {
+		return err
+	}
+	for _, conflict := range attachedConflicts {
+		conflict.Resource.CampaignKey = ""
+		if err := models.Store.Conflicts().Update(ctx, conflict.Key, &conflict.Resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -7,16 +7,11 @@
 package routes
 
 import (
-	"encoding/json"
+	gocontext "context"
 	"net/http"
 
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
-	"github.com/gorilla/context"
-	"github.com/gorilla/mux"
-	"github.com/mitchellh/mapstructure"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // Skill : data structure for character skills
@@ -45,172 +40,137 @@ type Character struct {
 	ParentKey  string
 } */
 
+// characters : PCs and NPCs belong to the user who created them and may join a campaign
+var characters = resource[models.Character]{
+	name:       "characters",
+	keyParam:   "characterKey",
+	repository: func() models.Repository[models.Character] { return models.Store.Characters() },
+	createArgs: map[string]string{
+		"Name":        "required",
+		"Concept":     "required",
+		"Mark":        "required",
+		"Passion":     "required",
+		"Traits":      "required",
+		"Skills":      "required",
+		"Powers":      "required",
+		"Background":  "required",
+		"Links":       "required",
+		"CampaignKey": "optional",
+	},
+	updateArgs: map[string]string{
+		"Name":        "optional",
+		"Concept":     "optional",
+		"Mark":        "optional",
+		"Passion":     "optional",
+		"Traits":      "optional",
+		"Skills":      "optional",
+		"Powers":      "optional",
+		"Background":  "optional",
+		"Links":       "optional",
+		"CampaignKey": "optional",
+	},
+	defaults: setParentKey,
+	// Players could put their own characters into their campaign
+	authorizeArgs: joinCampaign(models.ActionAddCharacter),
+	// New characters follow the character creation rules of their campaign. Existing ones may grow past them
+	validate: func(ctx gocontext.Context, key string, character models.Character) fieldErrors {
+		if key == "" {
+			return checkRules(ctx, key, character)
+		}
+		if utils.Contains(character.Links, key) {
+			return fieldErrors{"Links": {Code: "selfLink", Message: "A character could not be linked to itself"}}
+		}
+		return nil
+	},
+	scope:        ownResources,
+	beforeDelete: unlinkCharacter,
+}
+
 // CreateCharacters : endpoint to create a new character (both PC and NPC)
 func CreateCharacters(w http.ResponseWriter, r *http.Request) {
-	requiredArgs := map[string]string{
-		"Name":       "required",
-		"Concept":    "required",
-		"Mark":       "required",
-		"Passion":    "required",
-		"Traits":     "required",
-		"Skills":     "required",
-		"Powers":     "required",
-		"Background": "required",
-		"Links":      "required",
-	}
-
-	resourceMap := make(map[string]interface{})
-	resourceMap["ParentKey"] = context.Get(r, "currentUserKey")
-
-	var resource models.Character
-	models.CreateResource("characters", requiredArgs, resourceMap, resource, w, r)
-
-	/* characterMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
-		"Name":       "required",
-		"Concept":    "required",
-		"Mark":       "required",
-		"Passion":    "required",
-		"Traits":     "required",
-		"Skills":     "required",
-		"Powers":     "required",
-		"Background": "required",
-		"Links":      "required",
-	}
-
-	// Parse the request body and populate user
-	err := json.NewDecoder(r.Body).Decode(&characterMap)
-	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
-		return
-	}
-
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(characterMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
-		return
-	}
+	characters.create(w, r)
+}
 
-	var characterStruct Character
-	characterMap["ParentKey"] = context.Get(r, "currentUserKey")
-	err3 := mapstructure.Decode(characterMap, &characterStruct)
-	if err3 != nil {
-		utils.SendResponse(w, 500, err3.Error(), "error", nil)
-		return
-	}
+// UpdateCharacters : endpoint to update a character (both PC and NPC)
+func UpdateCharacters(w http.ResponseWriter, r *http.Request) {
+	characters.update(w, r)
+}
 
-	// Save to Datastore
-	characterKey, err4 := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, "characters", nil), &characterStruct)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
-		return
-	}
+// PatchCharacters : endpoint to partially update a character (both PC and NPC) with a JSON Merge Patch or a JSON Patch
+func PatchCharacters(w http.ResponseWriter, r *http.Request) {
+	characters.patch(w, r)
+}
 
-	data := make(map[string]string)
-	options := make(map[string]string)
-	location := fmt.Sprintf("%v://%v/api/characters/%v", r.URL.Scheme, r.Host, characterKey.Encode())
-	data["ID"] = characterKey.Encode()
-	options["Location"] = location
+// GetCharacters : endpoint to retrieve a character (both PC and NPC)
+// Its creator and the members of its campaign could retrieve it unless they're the admin
+func GetCharacters(w http.ResponseWriter, r *http.Request) {
+	characters.get(w, r)
+}
 
-	utils.SendResponse(w, 201, data, "success", options) */
+// ListCharacters : endpoint to list the characters (both PC and NPC) the requester created
+func ListCharacters(w http.ResponseWriter, r *http.Request) {
+	characters.list(w, r)
 }
 
-// UpdateCharacters : endpoint to update a character (both PC and NPC)
-func UpdateCharacters(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	characterMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
-		"Name":       "optional",
-		"Concept":    "optional",
-		"Mark":       "optional",
-		"Passion":    "optional",
-		"Traits":     "optional",
-		"Skills":     "optional",
-		"Powers":     "optional",
-		"Background": "optional",
-		"Links":      "optional",
-	}
+// DeleteCharacters : endpoint to delete a character (both PC and NPC)
+// Other characters linked to it and scene bonuses granted to it are cleaned up as well
+func DeleteCharacters(w http.ResponseWriter, r *http.Request) {
+	characters.delete(w, r)
+}
 
-	err := json.NewDecoder(r.Body).Decode(&characterMap)
+// unlinkCharacter : remove the links other characters have to a character, the scene bonuses it was granted
+// and take it out of the conflicts it's still fighting in
+func unlinkCharacter(ctx gocontext.Context, key string, character models.Character) error {
+	linked, err := models.Store.Characters().FindBy(ctx, "Links", key)
 	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
-		return
+		return err
 	}
 
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(characterMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
-		return
+	for _, other := range linked {
+		other.Resource.Links = utils.Remove(other.Resource.Links, key)
+		if err := models.Store.Characters().Update(ctx, other.Key, &other.Resource); err != nil {
+			return err
+		}
 	}
 
-	// Check if this user is eligible to update the target character by comparing access token's user key with the parent key of target character
-
-	key, err3 := datastore.DecodeKey(params["characterKey"])
-	if err3 != nil {
-		data := make(map[string]string)
-		data["Message"] = err3.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
+	bonused, err := models.Store.Scenes().FindBy(ctx, "Bonus.UserID", key)
+	if err != nil {
+		return err
 	}
 
-	// Because Datastore doesn't differentiate between creating and updating entity,
-	// we need to retrieve the old data first and modify it before commiting it to Datastore
-	var character models.Character
-
-	// Retrieve the old data
-	err5 := datastore.Get(ctx, key, &character)
-	if err5 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such user to update"
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-	if err5 != nil {
-		utils.SendResponse(w, 500, err5.Error(), "error", nil)
-		return
-	}
+	for _, scene := range bonused {
+		bonuses := make([]models.SceneBonus, 0, len(scene.Resource.Bonus))
+		for _, bonus := range scene.Resource.Bonus {
+			if bonus.UserID != key {
+				bonuses = append(bonuses, bonus)
+			}
+		}
+		scene.Resource.Bonus = bonuses
 
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the emails
-		currentUserKey := context.Get(r, "currentUserKey")
-		if character.ParentKey != currentUserKey {
-			// Different key. Hence, the user is not eligible to update the target character
-			data := make(map[string]string)
-			data["Message"] = "You are not eligible to update this character"
-			utils.SendResponse(w, 403, data, "fail", nil)
-			return
+		if err := models.Store.Scenes().Update(ctx, scene.Key, &scene.Resource); err != nil {
+			return err
 		}
 	}
 
-	// Overwrite it with the new one
-	err2 := mapstructure.Decode(characterMap, &character)
-	if err2 != nil {
-		utils.SendResponse(w, 500, err2.Error(), "error", nil)
-		return
+	fighting, err := models.Store.Conflicts().FindBy(ctx, "Participants.CharacterKey", key)
+	if err != nil {
+		return err
 	}
 
-	// Commit it to Datastore
-	_, err4 := datastore.Put(ctx, key, &character)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
-		return
-	}
+	for _, conflict := range fighting {
+		// Resolved conflicts are kept as they ended
+		if conflict.Resource.IsResolved {
+			continue
+		}
 
-	data := make(map[string]string)
-	data["Message"] = "OK"
+		// The round may have been waiting for it, or it may have been the last one standing on its side
+		if _, err := conflict.Resource.RemoveParticipant(key); err != nil {
+			return err
+		}
+		if err := models.Store.Conflicts().Update(ctx, conflict.Key, &conflict.Resource); err != nil {
+			return err
+		}
+	}
 
-	utils.SendResponse(w, 204, data, "success", nil)
+	return nil
 }
-
-// GetCharacters : endpoint to retrieve a character (both PC and NPC)
-func GetCharacters(w http.ResponseWriter, r *http.Request) {}
-
-// DeleteCharacters : endpoint to retrieve a character (both PC and NPC)
-func DeleteCharacters(w http.ResponseWriter, r *http.Request) {}
@@ -0,0 +1,99 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/dorklord23/anima-prime/dice"
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+)
+
+// commitments : the seeds of commit-reveal rolls. They're private to the user who asked for them
+var commitments = resource[models.Commitment]{
+	name:       "commitments",
+	keyParam:   "commitmentKey",
+	repository: func() models.Repository[models.Commitment] { return models.Store.Commitments() },
+	// The seed stays secret until a roll uses it
+	present: func(key string, commitment models.Commitment) (map[string]interface{}, error) {
+		data, err := resourceData(key, commitment)
+		if err != nil {
+			return nil, err
+		}
+
+		if !commitment.IsUsed {
+			delete(data, "Seed")
+		}
+
+		return data, nil
+	},
+}
+
+// CreateCommitments : endpoint to get a fresh secret seed for a commit-reveal roll. Only its hash is sent back
+func CreateCommitments(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+
+	seed, err := dice.NewServerSeed()
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	commitment := models.Commitment{
+		Hash:      dice.Commit(seed),
+		Seed:      hex.EncodeToString(seed),
+		ParentKey: models.RequesterOf(r).Key,
+	}
+
+	commitmentKey, err2 := models.Store.Commitments().Create(ctx, commitment)
+	if err2 != nil {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	options := make(map[string]string)
+	data["ID"] = commitmentKey
+	data["Hash"] = commitment.Hash
+	options["Location"] = fmt.Sprintf("%v://%v/api/%v/%v", r.URL.Scheme, r.Host, commitments.name, commitmentKey)
+
+	utils.SendResponse(w, 201, data, "success", options)
+}
+
+// GetCommitments : endpoint to retrieve a commitment. Its seed is only revealed once a roll has used it
+func GetCommitments(w http.ResponseWriter, r *http.Request) {
+	commitments.get(w, r)
+}
+
+// claimCommitment : mark a commitment of the requester as used, so its seed only ever rolls once.
+// Sends the failure response and returns false when it's already used
+func claimCommitment(key string, w http.ResponseWriter, r *http.Request) (models.Commitment, bool) {
+	commitment, ok := commitments.load(key, models.ActionUpdate, w, r)
+	if !ok {
+		return commitment, false
+	}
+
+	if commitment.IsUsed {
+		data := make(map[string]string)
+		data["Message"] = "This commitment has already been used"
+		utils.SendResponse(w, 409, data, "fail", nil)
+		return commitment, false
+	}
+
+	// Two rolls claiming it at once can't both succeed since the update fails on a version conflict
+	commitment.IsUsed = true
+	err := models.Store.Commitments().Update(models.NewContext(r), key, &commitment)
+	if err != nil {
+		sendUpdateError(err, w, r)
+		return commitment, false
+	}
+
+	return commitment, true
+}
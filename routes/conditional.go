@@ -0,0 +1,143 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+)
+
+// revalidate : responses are specific to the requester and clients should check they're still current before reusing them
+const revalidate = "private, no-cache"
+
+// etagOf : the entity tag of a resource, derived from its version
+func etagOf(resource interface{}) string {
+	return fmt.Sprintf("\"%v\"", models.VersionOf(resource))
+}
+
+// etagHeaders : the headers telling the client which version of a resource it got
+func etagHeaders(resource interface{}) map[string]string {
+	return map[string]string{"ETag": etagOf(resource)}
+}
+
+// validatorHeaders : the headers telling the client which version of a resource it got and when it was last modified
+func validatorHeaders(resource interface{}) map[string]string {
+	headers := etagHeaders(resource)
+	if modifiedAt := models.ModifiedAtOf(resource); !modifiedAt.IsZero() {
+		headers["Last-Modified"] = modifiedAt.UTC().Format(http.TimeFormat)
+	}
+
+	return headers
+}
+
+// pageValidatorHeaders : the headers telling the client which version of a listing it got.
+// Its entity tag is a digest of the payload and it was last modified along with the latest of its items
+func pageValidatorHeaders[T any](data interface{}, page models.Page[T]) (map[string]string, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(append(payload, page.NextCursor...))
+	headers := map[string]string{"ETag": fmt.Sprintf("\"%x\"", digest[:12])}
+
+	var lastModified time.Time
+	for _, item := range page.Items {
+		if modifiedAt := models.ModifiedAtOf(item.Resource); modifiedAt.After(lastModified) {
+			lastModified = modifiedAt
+		}
+	}
+	if !lastModified.IsZero() {
+		headers["Last-Modified"] = lastModified.UTC().Format(http.TimeFormat)
+	}
+
+	return headers, nil
+}
+
+// notModified : check the conditional headers of a GET against the validators of the response.
+// Sends 304 and returns true when the copy the client holds is still current.
+// If-None-Match takes precedence over If-Modified-Since, which is only trusted when checkModifiedSince is set
+func notModified(headers map[string]string, checkModifiedSince bool, w http.ResponseWriter, r *http.Request) bool {
+	fresh := false
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		fresh = etagMatches(header, headers["ETag"], true)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && checkModifiedSince {
+		modifiedAt, err2 := http.ParseTime(headers["Last-Modified"])
+		fresh = err2 == nil && !modifiedAt.After(since)
+	}
+
+	if !fresh {
+		return false
+	}
+
+	for key, value := range headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(304)
+
+	return true
+}
+
+// checkIfMatch : when the client sends If-Match, check the resource is still at the version the client read.
+// Sends 412 and returns false otherwise
+func checkIfMatch(resource interface{}, w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, etagOf(resource), false) {
+		return true
+	}
+
+	data := make(map[string]string)
+	data["Message"] = fmt.Sprintf("This %v has been modified since you retrieved it", resourceName(resource))
+	utils.SendResponse(w, 412, data, "fail", etagHeaders(resource))
+	return false
+}
+
+// etagMatches : check if a list of entity tags, as sent in If-Match or If-None-Match, holds etag.
+// If-Match uses the strong comparison, where weak tags never match, and If-None-Match the weak one
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sendUpdateError : send the failure response for an error returned by Repository.Update.
+// A version conflict means someone else updated the resource while this request was handled
+func sendUpdateError(err error, w http.ResponseWriter, r *http.Request) {
+	if err != models.ErrVersionConflict {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	data["Message"] = err.Error()
+
+	// The client said which version it based its changes on and that version is gone
+	if r.Header.Get("If-Match") != "" {
+		utils.SendResponse(w, 412, data, "fail", nil)
+		return
+	}
+
+	utils.SendResponse(w, 409, data, "fail", nil)
+}
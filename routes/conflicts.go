@@ -7,16 +7,11 @@
 package routes
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
-	"github.com/mitchellh/mapstructure"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // Conflict : data structure for conflicts
@@ -30,155 +25,269 @@ import (
 	ParentKey   string
 } */
 
-// CreateConflicts : endpoint to create a new conflict
-func CreateConflicts(w http.ResponseWriter, r *http.Request) {
-	requiredArgs := map[string]string{
+// conflicts : conflicts are created by GMs and may join one of their campaigns
+var conflicts = resource[models.Conflict]{
+	name:       "conflicts",
+	keyParam:   "conflictKey",
+	repository: func() models.Repository[models.Conflict] { return models.Store.Conflicts() },
+	createArgs: map[string]string{
 		"Name":        "required",
 		"Description": "required",
 		"Goal":        "required",
 		"Difficulty":  "required",
 		"Targets":     "required",
-	}
+		"CampaignKey": "optional",
+	},
+	updateArgs: map[string]string{
+		"Name":        "optional",
+		"Description": "optional",
+		"Goal":        "optional",
+		"Difficulty":  "optional",
+		"Targets":     "optional",
+		"IsResolved":  "optional",
+		"CampaignKey": "optional",
+	},
+	defaults: func(conflictMap map[string]interface{}, r *http.Request) {
+		conflictMap["IsResolved"] = false
+		setParentKey(conflictMap, r)
+	},
+	// Only the GMs of a campaign could add conflicts to it
+	authorizeArgs: joinCampaign(models.ActionAddContent),
+	scope:         ownResources,
+}
+
+// CreateConflicts : endpoint to create a new conflict
+func CreateConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.create(w, r)
+}
 
-	conflictMap := make(map[string]interface{})
-	conflictMap["IsResolved"] = false
-	conflictMap["ParentKey"] = context.Get(r, "currentUserKey")
+// UpdateConflicts : endpoint to update a conflict
+func UpdateConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.update(w, r)
+}
 
-	var conflict models.Conflict
-	models.CreateResource("conflicts", requiredArgs, conflictMap, conflict, w, r)
-	/* conflictMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
-		"Name":        "required",
-		"Description": "required",
-		"Goal":        "required",
-		"Difficulty":  "required",
-		"Targets":     "required",
+// PatchConflicts : endpoint to partially update a conflict with a JSON Merge Patch or a JSON Patch
+func PatchConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.patch(w, r)
+}
+
+// GetConflicts : endpoint to retrieve a conflict. Members of its campaign could retrieve it too
+func GetConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.get(w, r)
+}
+
+// ListConflicts : endpoint to list the conflicts the requester created
+func ListConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.list(w, r)
+}
+
+// DeleteConflicts : endpoint to delete a conflict
+func DeleteConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts.delete(w, r)
+}
+
+// participantArgs : the arguments of a character joining a conflict
+var participantArgs = map[string]string{
+	"CharacterKey": "required",
+	"Side":         "required",
+	"Resilience":   "optional",
+}
+
+// actionArgs : the arguments of an action taken during a conflict
+var actionArgs = map[string]string{
+	"CharacterKey": "required",
+	"Type":         "required",
+	"TargetKey":    "optional",
+	"Dice":         "optional",
+}
+
+// powerArgs : the arguments of a power activated during a conflict
+var powerArgs = map[string]string{
+	"CharacterKey": "required",
+	"PowerKey":     "required",
+	"Dice":         "required",
+}
+
+// AddConflictParticipants : endpoint for the GMs to bring a character of the campaign into a conflict, on either side.
+// Characters joining once the conflict has started act from the next round
+func AddConflictParticipants(w http.ResponseWriter, r *http.Request) {
+	participantMap, ok := decodeArgs("conflict-participants", participantArgs, w, r)
+	if !ok {
+		return
 	}
 
-	// Parse the request body and populate user
-	err := json.NewDecoder(r.Body).Decode(&conflictMap)
+	var participant models.ConflictParticipant
+	err := decodeInto(participantMap, &participant)
 	if err != nil {
 		utils.SendResponse(w, 500, err.Error(), "error", nil)
 		return
 	}
 
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(conflictMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
+	character, ok := characters.load(participant.CharacterKey, models.ActionRead, w, r)
+	if !ok {
 		return
 	}
 
-	var conflictStruct Conflict
-	conflictMap["ParentKey"] = context.Get(r, "currentUserKey")
-	conflictMap["IsResolved"] = false
-	err3 := mapstructure.Decode(conflictMap, &conflictStruct)
-	if err3 != nil {
-		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+	changeConflict(models.ActionUpdate, w, r, func(conflict *models.Conflict) error {
+		if character.CampaignKey != conflict.CampaignKey {
+			return models.Violation{Field: "CharacterKey", Code: "otherCampaign", Message: "Only the characters of the campaign of this conflict could take part in it"}
+		}
+		return conflict.AddParticipant(participant)
+	})
+}
+
+// RemoveConflictParticipants : endpoint for the GMs to take a character out of a conflict
+func RemoveConflictParticipants(w http.ResponseWriter, r *http.Request) {
+	characterKey := mux.Vars(r)["characterKey"]
+
+	changeConflict(models.ActionUpdate, w, r, func(conflict *models.Conflict) error {
+		removed, err := conflict.RemoveParticipant(characterKey)
+		if err == nil && !removed {
+			return models.ErrNotFound
+		}
+		return err
+	})
+}
+
+// StartConflicts : endpoint for the GMs to open the first round of a conflict
+func StartConflicts(w http.ResponseWriter, r *http.Request) {
+	changeConflict(models.ActionUpdate, w, r, func(conflict *models.Conflict) error {
+		return conflict.Start()
+	})
+}
+
+// TakeConflictActions : endpoint to take the turn of a participant. Those who could play the character could take it.
+// Strikes, achievements and charging powers spend strike dice of the participant
+func TakeConflictActions(w http.ResponseWriter, r *http.Request) {
+	actionMap, ok := decodeArgs("conflict-actions", actionArgs, w, r)
+	if !ok {
 		return
 	}
 
-	// Save to Datastore
-	conflictKey, err4 := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, "conflicts", nil), &conflictStruct)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+	var action models.ConflictAction
+	err := decodeInto(actionMap, &action)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if _, ok := characters.load(action.CharacterKey, models.ActionUpdate, w, r); !ok {
 		return
 	}
 
-	data := make(map[string]string)
-	options := make(map[string]string)
-	location := fmt.Sprintf("%v://%v/api/conflicts/%v", r.URL.Scheme, r.Host, conflictKey.Encode())
-	data["ID"] = conflictKey.Encode()
-	options["Location"] = location
+	invalidArgs := make(fieldErrors)
+	if action.Type == models.StrikeAction && action.TargetKey == "" {
+		invalidArgs.add("TargetKey", codeRequired, "A strike needs a target")
+	}
+	if models.SpendsDice(action.Type) && action.Dice == 0 {
+		invalidArgs.add("Dice", codeRequired, "This action spends strike dice")
+	}
+	if !models.SpendsDice(action.Type) && action.Dice != 0 {
+		invalidArgs.add("Dice", codeNotAllowed, "This action doesn't spend dice")
+	}
+	if len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
 
-	utils.SendResponse(w, 201, data, "success", options) */
+	// Members of the campaign could read the conflict and act in it with the characters they play
+	changeConflict(models.ActionRead, w, r, func(conflict *models.Conflict) error {
+		return conflict.Act(action)
+	})
 }
 
-// UpdateConflicts : endpoint to update a scene
-func UpdateConflicts(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	conflictMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
-		"Name":        "optional",
-		"Description": "optional",
-		"Goal":        "optional",
-		"Difficulty":  "optional",
-		"Targets":     "optional",
-		"IsResolved":  "optional",
+// ActivateConflictPowers : endpoint to spend charge dice of a participant to activate one of the powers of their character.
+// It could be done at any time during the conflict, without taking the turn of the participant
+func ActivateConflictPowers(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+
+	activationMap, ok := decodeArgs("conflict-powers", powerArgs, w, r)
+	if !ok {
+		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&conflictMap)
+	var activation models.ConflictAction
+	err := decodeInto(activationMap, &activation)
 	if err != nil {
 		utils.SendResponse(w, 500, err.Error(), "error", nil)
 		return
 	}
 
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(conflictMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
+	character, ok := characters.load(activation.CharacterKey, models.ActionUpdate, w, r)
+	if !ok {
 		return
 	}
 
-	// Check if this user is authorized to update the target scene by comparing access token's user key with the parent key of target scene
-	key, err3 := datastore.DecodeKey(params["conflictKey"])
-	if err3 != nil {
-		data := make(map[string]string)
-		data["Message"] = err3.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
+	_, err2 := models.Store.Powers().Get(ctx, activation.PowerKey)
+	if err2 != nil && err2 != models.ErrNotFound && err2 != models.ErrInvalidKey {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+	if err2 != nil || !utils.Contains(character.Powers, activation.PowerKey) {
+		invalidArgs := fieldErrors{"PowerKey": {Code: "unknown", Message: "This character has no such power"}}
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
 		return
 	}
 
-	// Because Datastore doesn't differentiate between creating and updating entity,
-	// we need to retrieve the old data first and modify it before commiting it to Datastore
-	var conflict models.Conflict
+	changeConflict(models.ActionRead, w, r, func(conflict *models.Conflict) error {
+		return conflict.ActivatePower(activation.CharacterKey, activation.PowerKey, activation.Dice)
+	})
+}
 
-	// Retrieve the old data
-	err5 := datastore.Get(ctx, key, &conflict)
-	if err5 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such conflict to update"
-		utils.SendResponse(w, 404, data, "fail", nil)
+// changeConflict : load the conflict of the request, let change run it through the conflict engine and save it.
+// Answers with the conflict, or with what the engine refused
+func changeConflict(action models.Action, w http.ResponseWriter, r *http.Request, change func(conflict *models.Conflict) error) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)["conflictKey"]
+
+	conflict, ok := conflicts.load(key, action, w, r)
+	if !ok || !checkIfMatch(conflict, w, r) {
+		return
+	}
+
+	err := change(&conflict)
+	if err != nil {
+		sendConflictError(err, w)
 		return
 	}
-	if err5 != nil {
-		utils.SendResponse(w, 500, err5.Error(), "error", nil)
+
+	// Two actions taken at once can't both go through since the update fails on a version conflict
+	err2 := models.Store.Conflicts().Update(ctx, key, &conflict)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
 		return
 	}
 
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the keys
-		currentUserKey := context.Get(r, "currentUserKey")
-		if conflict.ParentKey != currentUserKey {
-			// Different key. Hence, the user is not authorized to update the target character
+	data, err3 := conflicts.render(key, conflict)
+	if err3 != nil {
+		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		return
+	}
+
+	utils.SendResponse(w, 200, data, "success", validatorHeaders(conflict))
+}
+
+// sendConflictError : answer with what the conflict engine refused: 400 for the arguments and 409 for the state of the conflict
+func sendConflictError(err error, w http.ResponseWriter) {
+	if violation, ok := err.(models.Violation); ok {
+		if violation.Field == "" {
 			data := make(map[string]string)
-			data["Message"] = "You are not authorized to update this conflict"
-			utils.SendResponse(w, 403, data, "fail", nil)
+			data["Message"] = violation.Message
+			utils.SendResponse(w, 409, data, "fail", nil)
 			return
 		}
-	}
 
-	// Overwrite it with the new one
-	err2 := mapstructure.Decode(conflictMap, &conflict)
-	if err2 != nil {
-		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		invalidArgs := fieldErrors{violation.Field: {Code: violation.Code, Message: violation.Message}}
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
 		return
 	}
 
-	// Commit it to Datastore
-	_, err4 := datastore.Put(ctx, key, &conflict)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+	if err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "This character doesn't take part in this conflict"
+		utils.SendResponse(w, 404, data, "fail", nil)
 		return
 	}
 
-	data := make(map[string]string)
-	data["Message"] = "OK"
-
-	utils.SendResponse(w, 204, data, "success", nil)
+	utils.SendResponse(w, 500, err.Error(), "error", nil)
 }
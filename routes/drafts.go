@@ -0,0 +1,243 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/mux"
+)
+
+// draftStep : a step of character creation along with the character arguments it fills
+type draftStep struct {
+	name string
+	args map[string]string
+}
+
+// draftSteps : the steps of character creation, in the order the wizard goes through them
+var draftSteps = []draftStep{
+	{name: "concept", args: map[string]string{
+		"Name":       "required",
+		"Concept":    "required",
+		"Mark":       "required",
+		"Passion":    "required",
+		"Background": "required",
+	}},
+	{name: "traits", args: map[string]string{"Traits": "required"}},
+	{name: "skills", args: map[string]string{"Skills": "required"}},
+	{name: "powers", args: map[string]string{"Powers": "required"}},
+	{name: "links", args: map[string]string{"Links": "required"}},
+}
+
+// drafts : characters being created step by step. They're private to their creator until finalized
+var drafts = resource[models.Draft]{
+	name:       "drafts",
+	keyParam:   "draftKey",
+	repository: func() models.Repository[models.Draft] { return models.Store.Drafts() },
+	createArgs: map[string]string{
+		"Name":        "optional",
+		"CampaignKey": "optional",
+	},
+	defaults: func(draftMap map[string]interface{}, r *http.Request) {
+		draftMap["Steps"] = []string{}
+		setParentKey(draftMap, r)
+	},
+	// Only those who could add a character to a campaign could draft one for it
+	authorizeArgs: joinCampaign(models.ActionAddCharacter),
+	scope:         ownResources,
+	// Tell the wizard where to resume
+	present: func(key string, draft models.Draft) (map[string]interface{}, error) {
+		data, err := resourceData(key, draft)
+		if err != nil {
+			return nil, err
+		}
+
+		data["NextStep"] = "finalize"
+		for _, step := range draftSteps {
+			if !utils.Contains(draft.Steps, step.name) {
+				data["NextStep"] = step.name
+				break
+			}
+		}
+
+		return data, nil
+	},
+}
+
+// CreateDrafts : endpoint to start creating a character, optionally naming it and picking its campaign
+func CreateDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts.create(w, r)
+}
+
+// GetDrafts : endpoint to retrieve a draft along with the next step to fill
+func GetDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts.get(w, r)
+}
+
+// ListDrafts : endpoint to list the drafts of the requester
+func ListDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts.list(w, r)
+}
+
+// DeleteDrafts : endpoint to give up on a draft
+func DeleteDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts.delete(w, r)
+}
+
+// FillDraftSteps : endpoint to fill a step of a draft. The step is checked against the character creation rules
+// right away, so mistakes are caught where they're made rather than when finalizing
+func FillDraftSteps(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	params := mux.Vars(r)
+	key := params["draftKey"]
+
+	step, ok := findDraftStep(params["step"])
+	if !ok {
+		data := make(map[string]string)
+		data["Message"] = "There is no such step"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+
+	// Steps fill character arguments so they follow the schema of characters
+	stepMap, ok := decodeArgs(characters.name, step.args, w, r)
+	if !ok {
+		return
+	}
+
+	draft, ok := drafts.load(key, models.ActionUpdate, w, r)
+	if !ok || !checkIfMatch(draft, w, r) {
+		return
+	}
+
+	err := decodeInto(stepMap, &draft)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if invalidArgs := checkDraftStep(ctx, step, draft); invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	if !utils.Contains(draft.Steps, step.name) {
+		draft.Steps = append(draft.Steps, step.name)
+	}
+
+	err2 := models.Store.Drafts().Update(ctx, key, &draft)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
+		return
+	}
+
+	data, err3 := drafts.render(key, draft)
+	if err3 != nil {
+		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		return
+	}
+
+	utils.SendResponse(w, 200, data, "success", validatorHeaders(draft))
+}
+
+// FinalizeDrafts : endpoint to turn a draft whose every step is filled into a character.
+// The character is checked the way CreateCharacters would and the draft is deleted once it's created
+func FinalizeDrafts(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)["draftKey"]
+
+	draft, ok := drafts.load(key, models.ActionUpdate, w, r)
+	if !ok || !checkIfMatch(draft, w, r) {
+		return
+	}
+
+	invalidArgs := make(fieldErrors)
+	for _, step := range draftSteps {
+		if utils.Contains(draft.Steps, step.name) {
+			continue
+		}
+		for arg, rule := range step.args {
+			if rule == "required" {
+				invalidArgs.add(arg, codeRequired, fmt.Sprintf("Fill the %v step first", step.name))
+			}
+		}
+	}
+	if len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	// The requester may have left the campaign since the draft was started
+	if draft.CampaignKey != "" && !models.CheckCampaignAccess(ctx, draft.CampaignKey, models.ActionAddCharacter, w, r) {
+		return
+	}
+
+	// Its campaign may have changed its rules since the steps were filled as well
+	character := draft.Character()
+	if !characters.isValid(ctx, "", character, w) {
+		return
+	}
+
+	characterKey, err := models.Store.Characters().Create(ctx, character)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	err2 := models.Store.Drafts().Delete(ctx, key)
+	if err2 != nil {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	options := make(map[string]string)
+	data["ID"] = characterKey
+	options["Location"] = fmt.Sprintf("%v://%v/api/%v/%v", r.URL.Scheme, r.Host, characters.name, characterKey)
+
+	utils.SendResponse(w, 201, data, "success", options)
+}
+
+// findDraftStep : look a step up by name
+func findDraftStep(name string) (draftStep, bool) {
+	for _, step := range draftSteps {
+		if step.name == name {
+			return step, true
+		}
+	}
+
+	return draftStep{}, false
+}
+
+// checkDraftStep : the character creation rules a step breaks. The rules about the other steps are left for later
+func checkDraftStep(ctx gocontext.Context, step draftStep, draft models.Draft) fieldErrors {
+	errs := make(fieldErrors)
+
+	for field, err := range checkRules(ctx, "", draft.Character()) {
+		// The rules of the campaign couldn't be retrieved at all
+		if field == "CampaignKey" {
+			errs.add(field, err.Code, err.Message)
+		}
+
+		for arg := range step.args {
+			if field == arg || strings.HasPrefix(field, arg+".") {
+				errs.add(field, err.Code, err.Message)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
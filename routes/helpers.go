@@ -0,0 +1,105 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/mitchellh/mapstructure"
+)
+
+// resourceData : turn a resource into a response payload carrying its key as "ID"
+func resourceData(key string, resource interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+
+	err := mapstructure.Decode(resource, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	// mapstructure turns times into empty maps so format them like the other payloads do
+	v := reflect.Indirect(reflect.ValueOf(resource))
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if t, ok := v.Field(i).Interface().(time.Time); ok {
+			data[field.Name] = t.Format(time.RFC3339)
+		}
+	}
+
+	data["ID"] = key
+	return data, nil
+}
+
+// listResources : parse the listing parameters of the request and run the query, on top of the given filters.
+// Sends the failure response if the parameters are wrong
+func listResources[T any](repository models.Repository[T], filters []models.Filter, w http.ResponseWriter, r *http.Request) (models.Page[T], bool) {
+	query, invalidArgs := models.ParseQuery[T](r.URL.Query())
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return models.Page[T]{}, false
+	}
+	query.Filters = append(query.Filters, filters...)
+
+	page, err := repository.List(models.NewContext(r), query)
+	return checkPage(page, err, w)
+}
+
+// checkPage : send the failure response for an error returned while listing a page
+func checkPage[T any](page models.Page[T], err error, w http.ResponseWriter) (models.Page[T], bool) {
+	if err == models.ErrInvalidCursor {
+		data := make(map[string]string)
+		data["cursor"] = err.Error()
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return page, false
+	}
+	if err == models.ErrUnsortable {
+		data := make(map[string]string)
+		data["sort"] = err.Error()
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return page, false
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return page, false
+	}
+
+	return page, true
+}
+
+// pageHeaders : point to the next page, if any, with a Link header carrying the same parameters
+func pageHeaders[T any](r *http.Request, page models.Page[T]) map[string]string {
+	if page.NextCursor == "" {
+		return nil
+	}
+
+	values := r.URL.Query()
+	values.Set("cursor", page.NextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+
+	return map[string]string{"Link": fmt.Sprintf("<%v>; rel=\"next\"", next.String())}
+}
+
+// ownResources : filter restricting a listing to what the requester created
+func ownResources(r *http.Request) []models.Filter {
+	return []models.Filter{{Field: "ParentKey", Value: models.RequesterOf(r).Key}}
+}
+
+// resourceName : the lowercased type name of a resource, as used in messages
+func resourceName(resource interface{}) string {
+	return strings.ToLower(reflect.TypeOf(resource).Name())
+}
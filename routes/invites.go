@@ -0,0 +1,413 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/mux"
+	"github.com/mitchellh/mapstructure"
+)
+
+// defaultInviteLifetime : how long an invite stays valid when the GM doesn't say otherwise
+const defaultInviteLifetime = 7 * 24 * time.Hour
+
+// invites : invites are created with a random code and listed or revoked by those who manage their campaign
+var invites = resource[models.Invite]{
+	name:       "invites",
+	keyParam:   "inviteKey",
+	repository: func() models.Repository[models.Invite] { return models.Store.Invites() },
+	present: func(key string, invite models.Invite) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"ID":         key,
+			"Code":       invite.Code,
+			"Role":       invite.Role,
+			"ExpiresAt":  invite.ExpiresAt.Format(time.RFC3339),
+			"MaxUses":    invite.MaxUses,
+			"AcceptedBy": invite.AcceptedBy,
+			"DeclinedBy": invite.DeclinedBy,
+		}, nil
+	},
+}
+
+// CreateInvites : endpoint for a GM to generate an invite code for their campaign
+func CreateInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+	campaignKey := params["campaignKey"]
+	inviteMap := make(map[string]interface{})
+	requiredArgs := map[string]string{
+		"Role":           "optional",
+		"MaxUses":        "optional",
+		"ExpiresInHours": "optional",
+	}
+
+	// Parse the request body. An empty body creates an invite with the default settings
+	err := json.NewDecoder(r.Body).Decode(&inviteMap)
+	if err != nil && !errors.Is(err, io.EOF) {
+		data := make(map[string]string)
+		data["Message"] = "The request body must be a JSON object"
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return
+	}
+
+	// Check if there are any invalid arguments
+	invalidArgs := checkPayload(invites.name, inviteMap, requiredArgs)
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	// Only the owner and the GM could decide who joins their campaign
+	if !models.CheckCampaignAccess(ctx, campaignKey, models.ActionManage, w, r) {
+		return
+	}
+
+	var options struct {
+		Role           string
+		MaxUses        int
+		ExpiresInHours int
+	}
+	err2 := mapstructure.Decode(inviteMap, &options)
+	if err2 != nil {
+		utils.SendResponse(w, 400, map[string]string{"Message": err2.Error()}, "fail", nil)
+		return
+	}
+
+	// The schema only lets co-gm, player and spectator through
+	role := models.Role(options.Role)
+	if role == models.RoleNone {
+		role = models.RolePlayer
+	}
+
+	lifetime := defaultInviteLifetime
+	if options.ExpiresInHours > 0 {
+		lifetime = time.Duration(options.ExpiresInHours) * time.Hour
+	}
+
+	code, err3 := utils.RandomToken(12)
+	if err3 != nil {
+		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		return
+	}
+
+	invite := models.Invite{
+		CampaignKey: campaignKey,
+		Code:        code,
+		Role:        role,
+		ExpiresAt:   time.Now().Add(lifetime),
+		MaxUses:     options.MaxUses,
+		ParentKey:   models.RequesterOf(r).Key,
+	}
+
+	inviteKey, err4 := models.Store.Invites().Create(ctx, invite)
+	if err4 != nil {
+		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	headers := make(map[string]string)
+	location := fmt.Sprintf("%v://%v/api/invites/%v", r.URL.Scheme, r.Host, code)
+	data["ID"] = inviteKey
+	data["Code"] = code
+	data["ExpiresAt"] = invite.ExpiresAt.Format(time.RFC3339)
+	headers["Location"] = location
+
+	utils.SendResponse(w, 201, data, "success", headers)
+}
+
+// ListInvites : endpoint to list the invites of a campaign
+func ListInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if _, ok := campaigns.load(params["campaignKey"], models.ActionManage, w, r); !ok {
+		return
+	}
+
+	invites.listWhere(inCampaign(params["campaignKey"]), w, r)
+}
+
+// DeleteInvites : endpoint to revoke an invite before it expires. The invite must belong to the campaign of the path
+func DeleteInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+
+	invite, err := models.Store.Invites().Get(ctx, params["inviteKey"])
+	if err == nil && invite.CampaignKey != params["campaignKey"] {
+		err = models.ErrNotFound
+	}
+	if err == models.ErrInvalidKey || err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "There is no such invite"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	invites.delete(w, r)
+}
+
+// GetInvites : endpoint to preview the campaign an invite code leads to before accepting it
+func GetInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+
+	_, invite, ok := getUsableInvite(params["code"], w, r)
+	if !ok {
+		return
+	}
+
+	campaign, err := models.Store.Campaigns().Get(ctx, invite.CampaignKey)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	data := map[string]string{
+		"CampaignKey":  invite.CampaignKey,
+		"CampaignName": campaign.Name,
+		"Description":  campaign.Description,
+		"Role":         string(invite.Role),
+		"ExpiresAt":    invite.ExpiresAt.Format(time.RFC3339),
+	}
+
+	utils.SendResponse(w, 200, data, "success", nil)
+}
+
+// AcceptInvites : endpoint for the requester to join a campaign through an invite code
+func AcceptInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+	requester := models.RequesterOf(r)
+
+	inviteKey, invite, ok := getUsableInvite(params["code"], w, r)
+	if !ok {
+		return
+	}
+
+	campaign, err := models.Store.Campaigns().Get(ctx, invite.CampaignKey)
+	if err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "The campaign of this invite no longer exists"
+		utils.SendResponse(w, 410, data, "fail", nil)
+		return
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if campaign.RoleOf(requester.Key) != models.RoleNone {
+		data := make(map[string]string)
+		data["Message"] = "You are already taking part in this campaign"
+		utils.SendResponse(w, 409, data, "fail", nil)
+		return
+	}
+
+	// Claim a use of the invite first so concurrent accepts can't go past MaxUses.
+	// Those who left and come back with the same code already used theirs
+	claimed := !utils.Contains(invite.AcceptedBy, requester.Key)
+	if claimed {
+		invite.AcceptedBy = append(invite.AcceptedBy, requester.Key)
+	}
+	invite.DeclinedBy = utils.Remove(invite.DeclinedBy, requester.Key)
+	err2 := models.Store.Invites().Update(ctx, inviteKey, &invite)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
+		return
+	}
+
+	campaign.AddMember(requester.Key, invite.Role)
+	err3 := models.Store.Campaigns().Update(ctx, invite.CampaignKey, &campaign)
+	if err3 != nil {
+		// Give the use back since the requester didn't join
+		if claimed {
+			if err4 := releaseInvite(ctx, inviteKey, requester.Key); err4 != nil {
+				utils.SendResponse(w, 500, err4.Error(), "error", nil)
+				return
+			}
+		}
+
+		sendUpdateError(err3, w, r)
+		return
+	}
+
+	data := map[string]string{
+		"CampaignKey": invite.CampaignKey,
+		"Role":        string(invite.Role),
+	}
+
+	utils.SendResponse(w, 200, data, "success", nil)
+}
+
+// DeclineInvites : endpoint for the requester to turn an invite down so the GM knows
+func DeclineInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+	requester := models.RequesterOf(r)
+
+	inviteKey, invite, ok := getUsableInvite(params["code"], w, r)
+	if !ok {
+		return
+	}
+
+	if !utils.Contains(invite.DeclinedBy, requester.Key) {
+		invite.DeclinedBy = append(invite.DeclinedBy, requester.Key)
+
+		err := models.Store.Invites().Update(ctx, inviteKey, &invite)
+		if err != nil {
+			sendUpdateError(err, w, r)
+			return
+		}
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", nil)
+}
+
+// RemoveCampaignMembers : endpoint for a GM to remove someone from their campaign, or for a member to leave it.
+// The member's characters stay with them but leave the campaign
+func RemoveCampaignMembers(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ctx := models.NewContext(r)
+	campaignKey := params["campaignKey"]
+	userKey := params["userKey"]
+
+	campaign, err := models.Store.Campaigns().Get(ctx, campaignKey)
+	if err == models.ErrInvalidKey || err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = "There is no such campaign"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	role := campaign.RoleOf(userKey)
+	if role == models.RoleNone {
+		data := make(map[string]string)
+		data["Message"] = "This user is not taking part in this campaign"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return
+	}
+	if role == models.RoleOwner || role == models.RoleGM {
+		data := make(map[string]string)
+		data["Message"] = "Hand the campaign over to someone else before removing its owner or GM"
+		utils.SendResponse(w, 409, data, "fail", nil)
+		return
+	}
+
+	// Anyone could leave on their own
+	if userKey != models.RequesterOf(r).Key && !models.CheckAuthorization(ctx, models.ActionManage, campaign, w, r) {
+		return
+	}
+
+	campaign.RemoveMember(userKey)
+	err2 := models.Store.Campaigns().Update(ctx, campaignKey, &campaign)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
+		return
+	}
+
+	attachedCharacters, err3 := models.Store.Characters().FindBy(ctx, "CampaignKey", campaignKey)
+	if err3 != nil {
+		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		return
+	}
+
+	for _, character := range attachedCharacters {
+		if character.Resource.ParentKey != userKey {
+			continue
+		}
+
+		character.Resource.CampaignKey = ""
+		err4 := models.Store.Characters().Update(ctx, character.Key, &character.Resource)
+		if err4 != nil {
+			sendUpdateError(err4, w, r)
+			return
+		}
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", nil)
+}
+
+// releaseAttempts : how many times releaseInvite tries again when other users accept the invite in the meantime
+const releaseAttempts = 5
+
+// releaseInvite : take a user back off the users who accepted an invite.
+// Retried a few times while other users accept it in the meantime
+func releaseInvite(ctx gocontext.Context, inviteKey string, userKey string) error {
+	for attempt := 0; attempt < releaseAttempts; attempt++ {
+		invite, err := models.Store.Invites().Get(ctx, inviteKey)
+		if err != nil {
+			return err
+		}
+
+		invite.AcceptedBy = utils.Remove(invite.AcceptedBy, userKey)
+		err2 := models.Store.Invites().Update(ctx, inviteKey, &invite)
+		if err2 != models.ErrVersionConflict {
+			return err2
+		}
+	}
+
+	return models.ErrVersionConflict
+}
+
+// getUsableInvite : look an invite up by its code and check it could still be used. Sends the failure response otherwise
+func getUsableInvite(code string, w http.ResponseWriter, r *http.Request) (string, models.Invite, bool) {
+	ctx := models.NewContext(r)
+	var invite models.Invite
+
+	found, err := models.Store.Invites().FindBy(ctx, "Code", code)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return "", invite, false
+	}
+	if code == "" || len(found) == 0 {
+		data := make(map[string]string)
+		data["Message"] = "There is no such invite"
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return "", invite, false
+	}
+
+	invite = found[0].Resource
+
+	if time.Now().After(invite.ExpiresAt) {
+		data := make(map[string]string)
+		data["Message"] = "This invite has expired"
+		utils.SendResponse(w, 410, data, "fail", nil)
+		return "", invite, false
+	}
+
+	if invite.MaxUses > 0 && len(invite.AcceptedBy) >= invite.MaxUses {
+		data := make(map[string]string)
+		data["Message"] = "This invite has been used up"
+		utils.SendResponse(w, 410, data, "fail", nil)
+		return "", invite, false
+	}
+
+	return found[0].Key, invite, true
+}
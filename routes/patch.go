@@ -0,0 +1,286 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gorilla/mux"
+)
+
+// Media types accepted by PATCH
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// acceptPatch : advertised to clients sending a PATCH in any other media type
+var acceptPatch = map[string]string{"Accept-Patch": mergePatchType + ", " + jsonPatchType}
+
+// patch : endpoint to partially update a resource with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902).
+// Unlike update, a patch could remove elements from a list or set a field back to null.
+// Only the fields accepted by update could be patched
+func (res resource[T]) patch(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)[res.keyParam]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		data := make(map[string]string)
+		data["Message"] = "Send either " + mergePatchType + " or " + jsonPatchType
+		utils.SendResponse(w, 415, data, "fail", acceptPatch)
+		return
+	}
+
+	patchDoc, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	// The requester must be allowed to update the resource before learning anything from the patch
+	resourceStruct, ok := res.load(key, models.ActionUpdate, w, r)
+	if !ok || !checkIfMatch(resourceStruct, w, r) {
+		return
+	}
+
+	doc, err2 := json.Marshal(withEmptySlices(resourceStruct))
+	if err2 != nil {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+
+	var patchedDoc []byte
+	if mediaType == mergePatchType {
+		patchedDoc, ok = applyMergePatch(doc, patchDoc, res.updateArgs, w)
+	} else {
+		patchedDoc, ok = applyJSONPatch(doc, patchDoc, res.updateArgs, w)
+	}
+	if !ok {
+		return
+	}
+
+	// Run the same checks as update on the fields the patch changed
+	changed, err3 := changedFields(doc, patchedDoc)
+	if err3 != nil {
+		utils.SendResponse(w, 500, err3.Error(), "error", nil)
+		return
+	}
+
+	// Null resets a field so only check the values that are set
+	setFields := make(map[string]interface{})
+	for field, value := range changed {
+		if value != nil {
+			setFields[field] = value
+		}
+	}
+	if invalidArgs := schemaErrors(res.name, setFields); len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	var patched T
+	err4 := json.Unmarshal(patchedDoc, &patched)
+	if err4 != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err4, &typeErr) {
+			invalidArgs := make(fieldErrors)
+			invalidArgs.add(typeErr.Field, codeType, "This field must be a "+typeErr.Type.String())
+			utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+			return
+		}
+
+		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		return
+	}
+
+	if res.updateAction != nil {
+		if action := res.updateAction(changed); action != models.ActionUpdate {
+			if !models.CheckAuthorization(ctx, action, resourceStruct, w, r) {
+				return
+			}
+		}
+	}
+
+	if res.authorizeArgs != nil && !res.authorizeArgs(ctx, changed, w, r) {
+		return
+	}
+
+	if !res.isValid(ctx, key, patched, w) {
+		return
+	}
+
+	// Commit it to the storage backend, unless someone else did in the meantime
+	err5 := res.repository().Update(ctx, key, &patched)
+	if err5 != nil {
+		sendUpdateError(err5, w, r)
+		return
+	}
+
+	data, err6 := res.render(key, patched)
+	if err6 != nil {
+		utils.SendResponse(w, 500, err6.Error(), "error", nil)
+		return
+	}
+
+	utils.SendResponse(w, 200, data, "success", validatorHeaders(patched))
+}
+
+// applyMergePatch : apply a JSON Merge Patch touching only the fields in args. Sends the failure response otherwise
+func applyMergePatch(doc []byte, patchDoc []byte, args map[string]string, w http.ResponseWriter) ([]byte, bool) {
+	fields := make(map[string]json.RawMessage)
+	err := json.Unmarshal(patchDoc, &fields)
+	if err != nil {
+		data := make(map[string]string)
+		data["Message"] = "A merge patch must be a JSON object"
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return nil, false
+	}
+
+	invalidArgs := make(fieldErrors)
+	for field := range fields {
+		if _, ok := args[field]; !ok {
+			invalidArgs.add(field, codeNotAllowed, "This field could not be changed")
+		}
+	}
+	if len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return nil, false
+	}
+
+	patched, err2 := jsonpatch.MergePatch(doc, patchDoc)
+	if err2 != nil {
+		data := make(map[string]string)
+		data["Message"] = err2.Error()
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return nil, false
+	}
+
+	return patched, true
+}
+
+// applyJSONPatch : apply a JSON Patch whose operations only touch the fields in args. Sends the failure response otherwise.
+// A failed "test" operation answers 409 and an operation that can't be applied answers 422
+func applyJSONPatch(doc []byte, patchDoc []byte, args map[string]string, w http.ResponseWriter) ([]byte, bool) {
+	patch, err := jsonpatch.DecodePatch(patchDoc)
+	if err != nil {
+		data := make(map[string]string)
+		data["Message"] = "A JSON patch must be an array of operations"
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return nil, false
+	}
+
+	invalidArgs := make(fieldErrors)
+	for _, operation := range patch {
+		path, err := operation.Path()
+		if err != nil {
+			data := make(map[string]string)
+			data["Message"] = err.Error()
+			utils.SendResponse(w, 400, data, "fail", nil)
+			return nil, false
+		}
+
+		paths := []string{path}
+		if kind := operation.Kind(); kind == "move" || kind == "copy" {
+			from, err := operation.From()
+			if err != nil {
+				data := make(map[string]string)
+				data["Message"] = err.Error()
+				utils.SendResponse(w, 400, data, "fail", nil)
+				return nil, false
+			}
+			paths = append(paths, from)
+		}
+
+		for _, path := range paths {
+			field := pointerField(path)
+			if _, ok := args[field]; !ok {
+				invalidArgs.add(path, codeNotAllowed, "This field could not be changed")
+			}
+		}
+	}
+	if len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return nil, false
+	}
+
+	patched, err2 := patch.Apply(doc)
+	if errors.Is(err2, jsonpatch.ErrTestFailed) {
+		data := make(map[string]string)
+		data["Message"] = err2.Error()
+		utils.SendResponse(w, 409, data, "fail", nil)
+		return nil, false
+	}
+	if err2 != nil {
+		data := make(map[string]string)
+		data["Message"] = err2.Error()
+		utils.SendResponse(w, 422, data, "fail", nil)
+		return nil, false
+	}
+
+	return patched, true
+}
+
+// pointerField : the top-level field a JSON pointer (RFC 6901) points into
+func pointerField(pointer string) string {
+	field := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 2)[0]
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(field)
+}
+
+// changedFields : the top-level fields whose value differs between two JSON documents, along with their new value.
+// Fields the patch removed are reported as nil
+func changedFields(before []byte, after []byte) (map[string]interface{}, error) {
+	var oldFields, newFields map[string]interface{}
+
+	if err := json.Unmarshal(before, &oldFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &newFields); err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]interface{})
+	for field, value := range newFields {
+		if !reflect.DeepEqual(oldFields[field], value) {
+			changed[field] = value
+		}
+	}
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			changed[field] = nil
+		}
+	}
+
+	return changed, nil
+}
+
+// withEmptySlices : turn the nil slices of a resource into empty ones so patches could append to them.
+// Datastore loads empty lists back as nil
+func withEmptySlices[T any](resource T) T {
+	v := reflect.ValueOf(&resource).Elem()
+	if v.Kind() != reflect.Struct {
+		return resource
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Slice && field.IsNil() && field.CanSet() {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+		}
+	}
+
+	return resource
+}
@@ -0,0 +1,72 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dorklord23/anima-prime/models"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// TestChangedFieldsReportsRemovedFields : clearing the roster of a campaign must take the same role as setting it
+func TestChangedFieldsReportsRemovedFields(t *testing.T) {
+	campaign := models.Campaign{Name: "c", GMKey: "gm", ParentKey: "owner", Players: []string{"p"}}
+	doc, err := json.Marshal(withEmptySlices(campaign))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mergePatched, err := jsonpatch.MergePatch(doc, []byte(`{"Players": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operations, err := jsonpatch.DecodePatch([]byte(`[{"op": "remove", "path": "/Players"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonPatched, err := operations.Apply(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		patched []byte
+	}{
+		{"merge patch null", mergePatched},
+		{"JSON patch remove", jsonPatched},
+	}
+
+	for _, test := range tests {
+		changed, err := changedFields(doc, test.patched)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		value, ok := changed["Players"]
+		if !ok || value != nil {
+			t.Errorf("%v: changed %v, want Players set to nil", test.name, changed)
+		}
+		if action := campaigns.updateAction(changed); action != models.ActionManage {
+			t.Errorf("%v: needs %v, want %v", test.name, action, models.ActionManage)
+		}
+	}
+}
+
+func TestChangedFieldsSkipsUnchangedFields(t *testing.T) {
+	changed, err := changedFields([]byte(`{"Name": "a", "Players": []}`), []byte(`{"Name": "b", "Players": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 1 || changed["Name"] != "b" {
+		t.Errorf("changed %v, want only Name", changed)
+	}
+}
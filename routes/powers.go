@@ -7,16 +7,9 @@
 package routes
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/dorklord23/anima-prime/models"
-	"github.com/dorklord23/anima-prime/utils"
-	"github.com/gorilla/context"
-	"github.com/gorilla/mux"
-	"github.com/mitchellh/mapstructure"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // Modifier : data structure for modifiers
@@ -48,148 +41,53 @@ func (p Power) ApplyEffect() {
 	// Do nothing for now
 } */
 
-// CreatePowers : endpoint to create a new power
-func CreatePowers(w http.ResponseWriter, r *http.Request) {
-	requiredArgs := map[string]string{
-		"Name":        "required",
-		"Description": "required",
-		"Type":        "required",
-		"Effect":      "required",
-	}
-
-	powerMap := make(map[string]interface{})
-	powerMap["ParentKey"] = context.Get(r, "currentUserKey")
-
-	var power models.Power
-	models.CreateResource("powers", requiredArgs, powerMap, power, w, r)
-	/* resourceMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
+// powers : powers belong to the user who created them
+var powers = resource[models.Power]{
+	name:       "powers",
+	keyParam:   "resourceKey",
+	repository: func() models.Repository[models.Power] { return models.Store.Powers() },
+	createArgs: map[string]string{
 		"Name":        "required",
 		"Description": "required",
 		"Type":        "required",
 		"Effect":      "required",
-	}
-
-	// Parse the request body and populate user
-	err := json.NewDecoder(r.Body).Decode(&resourceMap)
-	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
-		return
-	}
-
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(resourceMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
-		return
-	}
-
-	var resourceStruct Power
-	resourceMap["ParentKey"] = context.Get(r, "currentUserKey")
-	err3 := mapstructure.Decode(resourceMap, &resourceStruct)
-	if err3 != nil {
-		utils.SendResponse(w, 500, err3.Error(), "error", nil)
-		return
-	}
-
-	// Save to Datastore
-	resourceKey, err4 := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, "powers", nil), &resourceStruct)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
-		return
-	}
-
-	data := make(map[string]string)
-	options := make(map[string]string)
-	location := fmt.Sprintf("%v://%v/api/powers/%v", r.URL.Scheme, r.Host, resourceKey.Encode())
-	data["ID"] = resourceKey.Encode()
-	options["Location"] = location
-
-	utils.SendResponse(w, 201, data, "success", options) */
-}
-
-// UpdatePowers : endpoint to update a scene
-func UpdatePowers(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	resourceMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
+	},
+	updateArgs: map[string]string{
 		"Name":        "optional",
 		"Description": "optional",
 		"Type":        "optional",
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&resourceMap)
-	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
-		return
-	}
-
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(resourceMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
-		return
-	}
-
-	// Check if this user is authorized to update the target scene by comparing access token's user key with the parent key of target scene
-	key, err3 := datastore.DecodeKey(params["resourceKey"])
-	if err3 != nil {
-		data := make(map[string]string)
-		data["Message"] = err3.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-
-	// Because Datastore doesn't differentiate between creating and updating entity,
-	// we need to retrieve the old data first and modify it before commiting it to Datastore
-	var resourceStruct models.Power
+		"Effect":      "optional",
+	},
+	defaults: setParentKey,
+	scope:    ownResources,
+}
 
-	// Retrieve the old data
-	err5 := datastore.Get(ctx, key, &resourceStruct)
-	if err5 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such conflict to update"
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-	if err5 != nil {
-		utils.SendResponse(w, 500, err5.Error(), "error", nil)
-		return
-	}
+// CreatePowers : endpoint to create a new power
+func CreatePowers(w http.ResponseWriter, r *http.Request) {
+	powers.create(w, r)
+}
 
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the keys
-		currentUserKey := context.Get(r, "currentUserKey")
-		if resourceStruct.ParentKey != currentUserKey {
-			// Different key. Hence, the user is not authorized to update the target character
-			data := make(map[string]string)
-			data["Message"] = "You are not authorized to update this conflict"
-			utils.SendResponse(w, 403, data, "fail", nil)
-			return
-		}
-	}
+// UpdatePowers : endpoint to update a power
+func UpdatePowers(w http.ResponseWriter, r *http.Request) {
+	powers.update(w, r)
+}
 
-	// Overwrite it with the new one
-	err2 := mapstructure.Decode(resourceMap, &resourceStruct)
-	if err2 != nil {
-		utils.SendResponse(w, 500, err2.Error(), "error", nil)
-		return
-	}
+// PatchPowers : endpoint to partially update a power with a JSON Merge Patch or a JSON Patch
+func PatchPowers(w http.ResponseWriter, r *http.Request) {
+	powers.patch(w, r)
+}
 
-	// Commit it to Datastore
-	_, err4 := datastore.Put(ctx, key, &resourceStruct)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
-		return
-	}
+// GetPowers : endpoint to retrieve a power
+func GetPowers(w http.ResponseWriter, r *http.Request) {
+	powers.get(w, r)
+}
 
-	data := make(map[string]string)
-	data["Message"] = "OK"
+// ListPowers : endpoint to list the powers the requester created
+func ListPowers(w http.ResponseWriter, r *http.Request) {
+	powers.list(w, r)
+}
 
-	utils.SendResponse(w, 204, data, "success", nil)
+// DeletePowers : endpoint to delete a power
+func DeletePowers(w http.ResponseWriter, r *http.Request) {
+	powers.delete(w, r)
 }
@@ -0,0 +1,349 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/mux"
+	"github.com/mitchellh/mapstructure"
+)
+
+// resource : the create, get, list, update and delete endpoints shared by every resource type.
+// Each route file declares one and fills in the hooks for whatever differs. Nil hooks are skipped
+type resource[T any] struct {
+	// name : the collection the resource lives in, as it appears in URLs
+	name string
+	// keyParam : the route variable holding the key of a resource
+	keyParam string
+	// repository : where the resources are stored. A function since the storage backend is only picked on startup
+	repository func() models.Repository[T]
+	// createArgs, updateArgs : the only arguments accepted on creation and on update, either "required" or "optional".
+	// Their types and constraints are declared in schemas/<name>.json
+	createArgs map[string]string
+	updateArgs map[string]string
+
+	// defaults : set the fields only the server decides on creation, e.g. ParentKey
+	defaults func(resourceMap map[string]interface{}, r *http.Request)
+	// authorizeArgs : check the requester may pass these arguments, e.g. the campaign the resource joins.
+	// Sends the failure response and returns false otherwise
+	authorizeArgs func(ctx gocontext.Context, resourceMap map[string]interface{}, w http.ResponseWriter, r *http.Request) bool
+	// updateAction : the action checked against the stored resource before an update. ActionUpdate by default
+	updateAction func(resourceMap map[string]interface{}) models.Action
+	// validate : return the invalid fields of a resource about to be saved, for the rules a schema can't express.
+	// key is empty on creation
+	validate func(ctx gocontext.Context, key string, resource T) fieldErrors
+	// scope : the filters restricting the collection to what the requester may list
+	scope func(r *http.Request) []models.Filter
+	// present : turn a resource into its response payload. resourceData by default
+	present func(key string, resource T) (map[string]interface{}, error)
+	// beforeDelete : clean up whatever refers to a resource about to be deleted
+	beforeDelete func(ctx gocontext.Context, key string, resource T) error
+}
+
+// create : endpoint to create a new resource
+func (res resource[T]) create(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+
+	resourceMap, ok := decodeArgs(res.name, res.createArgs, w, r)
+	if !ok {
+		return
+	}
+
+	if res.defaults != nil {
+		res.defaults(resourceMap, r)
+	}
+
+	if res.authorizeArgs != nil && !res.authorizeArgs(ctx, resourceMap, w, r) {
+		return
+	}
+
+	var resourceStruct T
+	err := decodeInto(resourceMap, &resourceStruct)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if !res.isValid(ctx, "", resourceStruct, w) {
+		return
+	}
+
+	// Save to the storage backend
+	resourceKey, err2 := res.repository().Create(ctx, resourceStruct)
+	if err2 != nil {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	options := make(map[string]string)
+	location := fmt.Sprintf("%v://%v/api/%v/%v", r.URL.Scheme, r.Host, res.name, resourceKey)
+	data["ID"] = resourceKey
+	options["Location"] = location
+
+	utils.SendResponse(w, 201, data, "success", options)
+}
+
+// get : endpoint to retrieve a resource. Only those allowed to read it could retrieve it
+func (res resource[T]) get(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)[res.keyParam]
+
+	resourceStruct, ok := res.load(key, models.ActionRead, w, r)
+	if !ok {
+		return
+	}
+
+	headers := validatorHeaders(resourceStruct)
+	headers["Cache-Control"] = revalidate
+	if notModified(headers, true, w, r) {
+		return
+	}
+
+	data, err := res.render(key, resourceStruct)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	utils.SendResponse(w, 200, data, "success", headers)
+}
+
+// list : endpoint to list the resources within the scope of the requester
+func (res resource[T]) list(w http.ResponseWriter, r *http.Request) {
+	var filters []models.Filter
+	if res.scope != nil {
+		filters = res.scope(r)
+	}
+
+	res.listWhere(filters, w, r)
+}
+
+// listWhere : respond with a page of the resources matching filters, on top of the listing parameters of the request
+func (res resource[T]) listWhere(filters []models.Filter, w http.ResponseWriter, r *http.Request) {
+	page, ok := listResources(res.repository(), filters, w, r)
+	if !ok {
+		return
+	}
+
+	res.sendPage(page, w, r)
+}
+
+// sendPage : respond with a page of resources, each carrying its key as "ID"
+func (res resource[T]) sendPage(page models.Page[T], w http.ResponseWriter, r *http.Request) {
+	data := make([]map[string]interface{}, 0, len(page.Items))
+	for _, item := range page.Items {
+		itemData, err := res.render(item.Key, item.Resource)
+		if err != nil {
+			utils.SendResponse(w, 500, err.Error(), "error", nil)
+			return
+		}
+
+		data = append(data, itemData)
+	}
+
+	headers, err := pageValidatorHeaders(data, page)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+	headers["Cache-Control"] = revalidate
+
+	// Removing an item from a listing doesn't change when the others were modified so only trust the entity tag
+	if notModified(headers, false, w, r) {
+		return
+	}
+
+	for key, value := range pageHeaders(r, page) {
+		headers[key] = value
+	}
+
+	utils.SendResponse(w, 200, data, "success", headers)
+}
+
+// update : endpoint to update a resource with the arguments supplied
+func (res resource[T]) update(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)[res.keyParam]
+
+	resourceMap, ok := decodeArgs(res.name, res.updateArgs, w, r)
+	if !ok {
+		return
+	}
+
+	action := models.ActionUpdate
+	if res.updateAction != nil {
+		action = res.updateAction(resourceMap)
+	}
+
+	// Because Datastore doesn't differentiate between creating and updating entity,
+	// we need to retrieve the old data first and modify it before commiting it
+	resourceStruct, ok := res.load(key, action, w, r)
+	if !ok || !checkIfMatch(resourceStruct, w, r) {
+		return
+	}
+
+	if res.authorizeArgs != nil && !res.authorizeArgs(ctx, resourceMap, w, r) {
+		return
+	}
+
+	// Overwrite it with the new one
+	err := decodeInto(resourceMap, &resourceStruct)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if !res.isValid(ctx, key, resourceStruct, w) {
+		return
+	}
+
+	// Commit it to the storage backend, unless someone else did in the meantime
+	err2 := res.repository().Update(ctx, key, &resourceStruct)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
+		return
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", validatorHeaders(resourceStruct))
+}
+
+// delete : endpoint to delete a resource, once whatever refers to it is cleaned up
+func (res resource[T]) delete(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)[res.keyParam]
+
+	resourceStruct, ok := res.load(key, models.ActionDelete, w, r)
+	if !ok || !checkIfMatch(resourceStruct, w, r) {
+		return
+	}
+
+	if res.beforeDelete != nil {
+		err := res.beforeDelete(ctx, key, resourceStruct)
+		if err != nil {
+			sendUpdateError(err, w, r)
+			return
+		}
+	}
+
+	err2 := res.repository().Delete(ctx, key)
+	if err2 != nil {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		return
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", nil)
+}
+
+// load : retrieve a resource and check the requester may perform action on it. Sends the failure response otherwise
+func (res resource[T]) load(key string, action models.Action, w http.ResponseWriter, r *http.Request) (T, bool) {
+	ctx := models.NewContext(r)
+
+	resourceStruct, err := res.repository().Get(ctx, key)
+	if err == models.ErrInvalidKey || err == models.ErrNotFound {
+		data := make(map[string]string)
+		data["Message"] = fmt.Sprintf("There is no such %v", resourceName(resourceStruct))
+		utils.SendResponse(w, 404, data, "fail", nil)
+		return resourceStruct, false
+	}
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return resourceStruct, false
+	}
+
+	if !models.CheckAuthorization(ctx, action, resourceStruct, w, r) {
+		return resourceStruct, false
+	}
+
+	return resourceStruct, true
+}
+
+func (res resource[T]) render(key string, resourceStruct T) (map[string]interface{}, error) {
+	if res.present != nil {
+		return res.present(key, resourceStruct)
+	}
+
+	return resourceData(key, resourceStruct)
+}
+
+func (res resource[T]) isValid(ctx gocontext.Context, key string, resourceStruct T, w http.ResponseWriter) bool {
+	if res.validate == nil {
+		return true
+	}
+
+	invalidArgs := res.validate(ctx, key, resourceStruct)
+	if len(invalidArgs) > 0 {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return false
+	}
+
+	return true
+}
+
+// decodeArgs : parse the request body and check it against the accepted arguments and the schema of a resource.
+// Arguments that aren't accepted are rejected so clients can't set fields like ParentKey
+func decodeArgs(schemaName string, args map[string]string, w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	resourceMap := make(map[string]interface{})
+
+	err := json.NewDecoder(r.Body).Decode(&resourceMap)
+	if err != nil {
+		data := make(map[string]string)
+		data["Message"] = "The request body must be a JSON object"
+		utils.SendResponse(w, 400, data, "fail", nil)
+		return nil, false
+	}
+
+	invalidArgs := checkPayload(schemaName, resourceMap, args)
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return nil, false
+	}
+
+	return resourceMap, true
+}
+
+// decodeInto : overwrite the fields of a resource with the arguments supplied.
+// Slices are replaced rather than merged so removing an element sticks
+func decodeInto(resourceMap map[string]interface{}, resourceStruct interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ZeroFields: true,
+		Result:     resourceStruct,
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(resourceMap)
+}
+
+// joinCampaign : authorizeArgs hook checking the requester may put the resource into the campaign it names
+func joinCampaign(action models.Action) func(gocontext.Context, map[string]interface{}, http.ResponseWriter, *http.Request) bool {
+	return func(ctx gocontext.Context, resourceMap map[string]interface{}, w http.ResponseWriter, r *http.Request) bool {
+		campaignKey, ok := resourceMap["CampaignKey"].(string)
+		if !ok || campaignKey == "" {
+			return true
+		}
+
+		return models.CheckCampaignAccess(ctx, campaignKey, action, w, r)
+	}
+}
+
+// setParentKey : defaults hook making the requester the creator of the resource
+func setParentKey(resourceMap map[string]interface{}, r *http.Request) {
+	resourceMap["ParentKey"] = models.RequesterOf(r).Key
+}
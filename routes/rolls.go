@@ -7,65 +7,30 @@
 package routes
 
 import (
+	gocontext "context"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"github.com/dorklord23/anima-prime/dice"
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // ChangeTraitTick : change a character's trait's tick status (tick/untick)
 func ChangeTraitTick(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	ctx := appengine.NewContext(r)
-	// characterMap := make(map[string]interface{})
+	ctx := models.NewContext(r)
+	key := params["characterKey"]
 
-	// Check if this user is authorized to update the target character by comparing access token's user key with the parent key of target character
-
-	key, err3 := datastore.DecodeKey(params["characterKey"])
-	if err3 != nil {
-		data := make(map[string]string)
-		data["Message"] = err3.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
+	// Check if the requester is allowed to update this character
+	character, ok := characters.load(key, models.ActionUpdate, w, r)
+	if !ok || !checkIfMatch(character, w, r) {
 		return
 	}
 
-	// Because Datastore doesn't differentiate between creating and updating entity,
-	// we need to retrieve the old data first and modify it before commiting it to Datastore
-	var character models.Character
-
-	// Retrieve the old data
-	err5 := datastore.Get(ctx, key, &character)
-	if err5 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such character"
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-	if err5 != nil {
-		utils.SendResponse(w, 500, err5.Error(), "error", nil)
-		return
-	}
-
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the emails
-		currentUserKey := context.Get(r, "currentUserKey")
-		if character.ParentKey != currentUserKey {
-			// Different key. Hence, the user is not authorized to update the target character
-			data := make(map[string]string)
-			data["Message"] = "You are not authorized to update this character"
-			utils.SendResponse(w, 403, data, "fail", nil)
-			return
-		}
-	}
-
 	// Change the tick status
 	index, err := strconv.Atoi(params["traitIndex"])
 	if err != nil {
@@ -96,17 +61,328 @@ func ChangeTraitTick(w http.ResponseWriter, r *http.Request) {
 		return
 	} */
 
-	// Commit it to Datastore
-	_, err4 := datastore.Put(ctx, key, &character)
+	// Commit it to the storage backend
+	err4 := models.Store.Characters().Update(ctx, key, &character)
 	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		sendUpdateError(err4, w, r)
 		return
 	}
 
 	data := make(map[string]string)
 	data["Message"] = "OK"
 
-	utils.SendResponse(w, 204, data, "success", nil)
+	utils.SendResponse(w, 204, data, "success", validatorHeaders(character))
+}
+
+// rolls : skill rolls, kept for the record. They're only created by RollSkills and never changed afterwards
+var rolls = resource[models.Roll]{
+	name:       "rolls",
+	keyParam:   "rollKey",
+	repository: func() models.Repository[models.Roll] { return models.Store.Rolls() },
+}
+
+// rollArgs : the arguments of a skill roll. Every bonus die is optional
+var rollArgs = map[string]string{
+	"SkillID":     "required",
+	"Purpose":     "optional",
+	"Traits":      "optional",
+	"SceneKey":    "optional",
+	"ConflictKey": "optional",
+	"ChargeDice":  "optional",
+	// Both or neither for a commit-reveal roll
+	"CommitmentKey": "optional",
+	"ClientSeed":    "optional",
+}
+
+// rollRequest : what a skill roll asks for
+type rollRequest struct {
+	SkillID string
+	Purpose string
+	// Traits : the indexes of the ticked traits giving a bonus die each
+	Traits []int
+	// SceneKey : the scene whose bonuses granted to the character give a bonus die each
+	SceneKey string
+	// ConflictKey : the conflict the roll is made in, if any
+	ConflictKey string
+	ChargeDice  int
+	// CommitmentKey : the commitment whose seed, along with ClientSeed, rolls the dice of a commit-reveal roll
+	CommitmentKey string
+	ClientSeed    string
+}
+
+// RollSkills : endpoint to roll for a skill of a character. Every roll starts with the base dice,
+// plus a bonus die per ticked trait picked, per scene bonus granted to the character and per charge die.
+// Dice showing at least the threshold of the skill rating are successes. The roll is kept in the roll log.
+// In a conflict the character takes part in, the charge dice are spent from the participant and the successes become strike dice
+func RollSkills(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)["characterKey"]
+
+	rollMap, ok := decodeArgs("rolls", rollArgs, w, r)
+	if !ok {
+		return
+	}
+
+	// Only those who could play the character could roll for it
+	character, ok := characters.load(key, models.ActionUpdate, w, r)
+	if !ok {
+		return
+	}
+
+	var request rollRequest
+	err := decodeInto(rollMap, &request)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if (request.CommitmentKey == "") != (request.ClientSeed == "") {
+		invalidArgs := fieldErrors{
+			"CommitmentKey": {Code: codeRequired, Message: "A commit-reveal roll needs both a commitment and a client seed"},
+		}
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	skill, found := findSkill(character, request.SkillID)
+	if !found {
+		invalidArgs := fieldErrors{"SkillID": {Code: "unknown", Message: "This character has no such skill"}}
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	pool := make([]models.RolledDie, 0, models.BaseDice+len(request.Traits)+request.ChargeDice)
+	for i := 0; i < models.BaseDice; i++ {
+		pool = append(pool, models.RolledDie{Source: models.SourceBase})
+	}
+
+	traitDice, invalidArgs := traitBonusDice(character, request.Traits)
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+	pool = append(pool, traitDice...)
+
+	if request.SceneKey != "" {
+		scene, ok := scenes.load(request.SceneKey, models.ActionRead, w, r)
+		if !ok {
+			return
+		}
+
+		for _, bonus := range scene.Bonus {
+			if bonus.UserID == key {
+				pool = append(pool, models.RolledDie{Source: models.SourceSceneBonus, Detail: bonus.BonusID})
+			}
+		}
+	}
+
+	// The charge dice of a participant come out of what they banked in the conflict
+	var conflict models.Conflict
+	isParticipant := false
+	if request.ConflictKey != "" {
+		conflict, ok = conflicts.load(request.ConflictKey, models.ActionRead, w, r)
+		if !ok {
+			return
+		}
+
+		isParticipant = conflict.Participant(key) != nil
+		if isParticipant && !canAddRoll(conflict, key, request.ChargeDice, w) {
+			return
+		}
+	}
+
+	// Charge dice are banked during a conflict so there are none to spend outside of one
+	if request.ChargeDice > 0 && !isParticipant {
+		invalidArgs := fieldErrors{"ChargeDice": {Code: "notParticipant", Message: "Only participants of the conflict of the roll have charge dice to spend"}}
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	for i := 0; i < request.ChargeDice; i++ {
+		pool = append(pool, models.RolledDie{Source: models.SourceCharge})
+	}
+
+	roller := dice.Default
+
+	// The seed was committed to before the client picked its own so neither side could pick the dice
+	var commitment models.Commitment
+	if request.CommitmentKey != "" {
+		commitment, ok = claimCommitment(request.CommitmentKey, w, r)
+		if !ok {
+			return
+		}
+
+		seed, err2 := hex.DecodeString(commitment.Seed)
+		if err2 != nil {
+			utils.SendResponse(w, 500, err2.Error(), "error", nil)
+			return
+		}
+		roller = dice.New(dice.Fair(seed, request.ClientSeed))
+	}
+
+	roll := models.NewRoll(skill, pool, roller.Roll(len(pool)))
+	if request.CommitmentKey != "" {
+		roll.CommitmentKey = request.CommitmentKey
+		roll.SeedHash = commitment.Hash
+		roll.ServerSeed = commitment.Seed
+		roll.ClientSeed = request.ClientSeed
+	}
+	roll.CharacterKey = key
+	roll.Purpose = request.Purpose
+	roll.SceneKey = request.SceneKey
+	roll.ConflictKey = request.ConflictKey
+	roll.CampaignKey = character.CampaignKey
+	roll.ParentKey = models.RequesterOf(r).Key
+
+	var participantConflict *models.Conflict
+	if isParticipant {
+		participantConflict = &conflict
+	}
+
+	rollKey, err3 := saveRoll(ctx, roll, request.ChargeDice, participantConflict)
+	if err3 != nil {
+		// A claimed commitment stays used since its seed is revealed as soon as it's claimed
+		if _, ok := err3.(models.Violation); ok {
+			sendConflictError(err3, w)
+		} else {
+			sendUpdateError(err3, w, r)
+		}
+		return
+	}
+
+	// Read it back to get the timestamps set by the storage backend
+	stored, err4 := models.Store.Rolls().Get(ctx, rollKey)
+	if err4 != nil {
+		utils.SendResponse(w, 500, err4.Error(), "error", nil)
+		return
+	}
+
+	data, err5 := rolls.render(rollKey, stored)
+	if err5 != nil {
+		utils.SendResponse(w, 500, err5.Error(), "error", nil)
+		return
+	}
+
+	options := make(map[string]string)
+	options["Location"] = fmt.Sprintf("%v://%v/api/%v/%v", r.URL.Scheme, r.Host, rolls.name, rollKey)
+
+	utils.SendResponse(w, 201, data, "success", options)
+}
+
+// GetRolls : endpoint to retrieve a roll. Those who could read the campaign of the character could retrieve it
+func GetRolls(w http.ResponseWriter, r *http.Request) {
+	rolls.get(w, r)
+}
+
+// ListCharacterRolls : endpoint to list the rolls made for a character
+func ListCharacterRolls(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["characterKey"]
+
+	if _, ok := characters.load(key, models.ActionRead, w, r); !ok {
+		return
+	}
+
+	rolls.listWhere([]models.Filter{{Field: "CharacterKey", Value: key}}, w, r)
+}
+
+// ListSceneRolls : endpoint to list the rolls made during a scene
+func ListSceneRolls(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["sceneKey"]
+
+	if _, ok := scenes.load(key, models.ActionRead, w, r); !ok {
+		return
+	}
+
+	rolls.listWhere([]models.Filter{{Field: "SceneKey", Value: key}}, w, r)
+}
+
+// ListConflictRolls : endpoint to list the rolls made during a conflict
+func ListConflictRolls(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["conflictKey"]
+
+	if _, ok := conflicts.load(key, models.ActionRead, w, r); !ok {
+		return
+	}
+
+	rolls.listWhere([]models.Filter{{Field: "ConflictKey", Value: key}}, w, r)
+}
+
+// canAddRoll : whether a participant could roll in a conflict, checked before rolling so a refused roll
+// doesn't use up a commitment
+func canAddRoll(conflict models.Conflict, characterKey string, chargeDice int, w http.ResponseWriter) bool {
+	conflict.Participants = append([]models.ConflictParticipant(nil), conflict.Participants...)
+	conflict.Actions = nil
+
+	err := conflict.AddRoll(characterKey, "", 0, chargeDice)
+	if err != nil {
+		sendConflictError(err, w)
+		return false
+	}
+
+	return true
+}
+
+// saveRoll : add a roll to the roll log. For a participant of a conflict, its successes go into their strike dice
+// and its charge dice come out of their charge dice, the roll being taken back if the conflict couldn't be updated
+func saveRoll(ctx gocontext.Context, roll models.Roll, chargeDice int, conflict *models.Conflict) (string, error) {
+	rollKey, err := models.Store.Rolls().Create(ctx, roll)
+	if err != nil || conflict == nil {
+		return rollKey, err
+	}
+
+	err2 := conflict.AddRoll(roll.CharacterKey, rollKey, roll.Successes, chargeDice)
+	if err2 == nil {
+		err2 = models.Store.Conflicts().Update(ctx, roll.ConflictKey, conflict)
+	}
+	if err2 == nil {
+		return rollKey, nil
+	}
+
+	if err3 := models.Store.Rolls().Delete(ctx, rollKey); err3 != nil {
+		return "", err3
+	}
+
+	return "", err2
+}
+
+// findSkill : look a skill of a character up by its ID
+func findSkill(character models.Character, skillID string) (models.Skill, bool) {
+	for _, skill := range character.Skills {
+		if skill.ID == skillID {
+			return skill, true
+		}
+	}
+
+	return models.Skill{}, false
+}
+
+// traitBonusDice : a bonus die per trait picked. Only ticked traits give one, and only once per roll
+func traitBonusDice(character models.Character, indexes []int) ([]models.RolledDie, fieldErrors) {
+	errs := make(fieldErrors)
+	dice := make([]models.RolledDie, 0, len(indexes))
+	picked := make(map[int]bool)
+
+	for i, index := range indexes {
+		field := fmt.Sprintf("Traits.%v", i)
+
+		switch {
+		case index >= len(character.Traits):
+			errs.add(field, "unknown", "This character has no such trait")
+		case picked[index]:
+			errs.add(field, "duplicate", "This trait is already picked")
+		case !character.Traits[index].IsTicked:
+			errs.add(field, "unticked", "Only ticked traits give a bonus die")
+		default:
+			dice = append(dice, models.RolledDie{Source: models.SourceTrait, Detail: character.Traits[index].Value})
+		}
+		picked[index] = true
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return dice, nil
 }
 
 // Reroll : reroll arbitrary number of dice
@@ -118,7 +394,7 @@ func Reroll(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := make(map[string][]int)
-	data["Dice"] = utils.DieRandomizer(dieQty)
+	data["Dice"] = dice.Default.Roll(dieQty)
 
 	utils.SendResponse(w, 200, data, "success", nil)
 }
@@ -0,0 +1,118 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"github.com/dorklord23/anima-prime/middlewares"
+	"github.com/gorilla/mux"
+)
+
+// NewRouter : function to build the router serving every endpoint under "/api".
+// It is shared by the App Engine entrypoint and the standalone server
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+	s := r.PathPrefix("/api").Subrouter()
+
+	// The only non-RESTful endpoint in this API to accomodate login
+	s.HandleFunc("/login", AuthenticateUser).Methods("POST")
+	s.HandleFunc("/logout", Logout).Methods("POST")
+
+	s.HandleFunc("/users", CreateUsers).Methods("POST")
+	s.HandleFunc("/users/{userKey}", UpdateUsers).Methods("PUT")
+	s.HandleFunc("/users/{userKey}", PatchUsers).Methods("PATCH")
+	s.HandleFunc("/users/{userKey}", GetUsers).Methods("GET")
+	s.HandleFunc("/users/{userKey}/tokens", RevokeUserTokens).Methods("DELETE")
+
+	s.HandleFunc("/campaigns", CreateCampaigns).Methods("POST")
+	s.HandleFunc("/campaigns", ListCampaigns).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}", UpdateCampaigns).Methods("PUT")
+	s.HandleFunc("/campaigns/{campaignKey}", PatchCampaigns).Methods("PATCH")
+	s.HandleFunc("/campaigns/{campaignKey}", GetCampaigns).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}", DeleteCampaigns).Methods("DELETE")
+	s.HandleFunc("/campaigns/{campaignKey}/characters", ListCampaignCharacters).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}/scenes", ListCampaignScenes).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}/conflicts", ListCampaignConflicts).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}/invites", CreateInvites).Methods("POST")
+	s.HandleFunc("/campaigns/{campaignKey}/invites", ListInvites).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}/invites/{inviteKey}", DeleteInvites).Methods("DELETE")
+	s.HandleFunc("/campaigns/{campaignKey}/players/{userKey}", RemoveCampaignMembers).Methods("DELETE")
+	s.HandleFunc("/campaigns/{campaignKey}/rules", GetCampaignRules).Methods("GET")
+	s.HandleFunc("/campaigns/{campaignKey}/rules", UpdateCampaignRules).Methods("PUT")
+	s.HandleFunc("/campaigns/{campaignKey}/rules", DeleteCampaignRules).Methods("DELETE")
+
+	s.HandleFunc("/invites/{code}", GetInvites).Methods("GET")
+	s.HandleFunc("/invites/{code}/accept", AcceptInvites).Methods("POST")
+	s.HandleFunc("/invites/{code}/decline", DeclineInvites).Methods("POST")
+
+	s.HandleFunc("/characters", CreateCharacters).Methods("POST")
+	s.HandleFunc("/characters", ListCharacters).Methods("GET")
+	s.HandleFunc("/characters/{characterKey}", UpdateCharacters).Methods("PUT")
+	s.HandleFunc("/characters/{characterKey}", PatchCharacters).Methods("PATCH")
+	s.HandleFunc("/characters/{characterKey}", GetCharacters).Methods("GET")
+	s.HandleFunc("/characters/{characterKey}", DeleteCharacters).Methods("DELETE")
+	s.HandleFunc("/characters/{characterKey}/violations", GetCharacterViolations).Methods("GET")
+
+	s.HandleFunc("/drafts", CreateDrafts).Methods("POST")
+	s.HandleFunc("/drafts", ListDrafts).Methods("GET")
+	s.HandleFunc("/drafts/{draftKey}", GetDrafts).Methods("GET")
+	s.HandleFunc("/drafts/{draftKey}", DeleteDrafts).Methods("DELETE")
+	s.HandleFunc("/drafts/{draftKey}/steps/{step}", FillDraftSteps).Methods("PUT")
+	s.HandleFunc("/drafts/{draftKey}/finalize", FinalizeDrafts).Methods("POST")
+
+	s.HandleFunc("/scenes", CreateScenes).Methods("POST")
+	s.HandleFunc("/scenes", ListScenes).Methods("GET")
+	s.HandleFunc("/scenes/{sceneKey}", UpdateScenes).Methods("PUT")
+	s.HandleFunc("/scenes/{sceneKey}", PatchScenes).Methods("PATCH")
+	s.HandleFunc("/scenes/{sceneKey}", GetScenes).Methods("GET")
+	s.HandleFunc("/scenes/{sceneKey}", DeleteScenes).Methods("DELETE")
+
+	s.HandleFunc("/conflicts", CreateConflicts).Methods("POST")
+	s.HandleFunc("/conflicts", ListConflicts).Methods("GET")
+	s.HandleFunc("/conflicts/{conflictKey}", UpdateConflicts).Methods("PUT")
+	s.HandleFunc("/conflicts/{conflictKey}", PatchConflicts).Methods("PATCH")
+	s.HandleFunc("/conflicts/{conflictKey}", GetConflicts).Methods("GET")
+	s.HandleFunc("/conflicts/{conflictKey}", DeleteConflicts).Methods("DELETE")
+	s.HandleFunc("/conflicts/{conflictKey}/participants", AddConflictParticipants).Methods("POST")
+	s.HandleFunc("/conflicts/{conflictKey}/participants/{characterKey}", RemoveConflictParticipants).Methods("DELETE")
+	s.HandleFunc("/conflicts/{conflictKey}/start", StartConflicts).Methods("POST")
+	s.HandleFunc("/conflicts/{conflictKey}/actions", TakeConflictActions).Methods("POST")
+	s.HandleFunc("/conflicts/{conflictKey}/powers", ActivateConflictPowers).Methods("POST")
+
+	s.HandleFunc("/powers", CreatePowers).Methods("POST")
+	s.HandleFunc("/powers", ListPowers).Methods("GET")
+	s.HandleFunc("/powers/{resourceKey}", UpdatePowers).Methods("PUT")
+	s.HandleFunc("/powers/{resourceKey}", PatchPowers).Methods("PATCH")
+	s.HandleFunc("/powers/{resourceKey}", GetPowers).Methods("GET")
+	s.HandleFunc("/powers/{resourceKey}", DeletePowers).Methods("DELETE")
+
+	s.HandleFunc("/eidolons", CreateEidolons).Methods("POST")
+	s.HandleFunc("/eidolons", ListEidolons).Methods("GET")
+	s.HandleFunc("/eidolons/{resourceKey}", UpdateEidolons).Methods("PUT")
+	s.HandleFunc("/eidolons/{resourceKey}", PatchEidolons).Methods("PATCH")
+	s.HandleFunc("/eidolons/{resourceKey}", GetEidolons).Methods("GET")
+	s.HandleFunc("/eidolons/{resourceKey}", DeleteEidolons).Methods("DELETE")
+
+	s.HandleFunc("/characters/{characterKey}/traits/{traitIndex}", ChangeTraitTick).Methods("PUT")
+	s.HandleFunc("/characters/{characterKey}/rolls", RollSkills).Methods("POST")
+	s.HandleFunc("/characters/{characterKey}/rolls", ListCharacterRolls).Methods("GET")
+	s.HandleFunc("/scenes/{sceneKey}/rolls", ListSceneRolls).Methods("GET")
+	s.HandleFunc("/conflicts/{conflictKey}/rolls", ListConflictRolls).Methods("GET")
+	s.HandleFunc("/rolls/{rollKey}", GetRolls).Methods("GET")
+	s.HandleFunc("/commitments", CreateCommitments).Methods("POST")
+	s.HandleFunc("/commitments/{commitmentKey}", GetCommitments).Methods("GET")
+
+	s.HandleFunc("/rerolls", Reroll).Methods("GET")
+
+	s.HandleFunc("/tokens", RefreshAccessToken).Methods("GET")
+
+	s.HandleFunc("/sessions", GetSessions).Methods("GET")
+	s.HandleFunc("/sessions/{sessionKey}", DeleteSessions).Methods("DELETE")
+
+	s.Use(middlewares.Authenticate)
+
+	return r
+}
@@ -0,0 +1,174 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	gocontext "context"
+	"fmt"
+	"net/http"
+
+	"github.com/dorklord23/anima-prime/models"
+	"github.com/dorklord23/anima-prime/utils"
+	"github.com/gorilla/mux"
+	"github.com/mitchellh/mapstructure"
+)
+
+// rulesArgs : the rules a GM could override. Those left out keep their current value
+var rulesArgs = map[string]string{
+	"Traits": "optional",
+	"Skills": "optional",
+	"Powers": "optional",
+	"Links":  "optional",
+}
+
+// GetCampaignRules : endpoint to retrieve the character creation rules of a campaign, whether they're house rules or not
+func GetCampaignRules(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := campaigns.load(mux.Vars(r)["campaignKey"], models.ActionRead, w, r)
+	if !ok {
+		return
+	}
+
+	headers := validatorHeaders(campaign)
+	headers["Cache-Control"] = revalidate
+	if notModified(headers, true, w, r) {
+		return
+	}
+
+	sendRules(campaign, headers, w)
+}
+
+// UpdateCampaignRules : endpoint for the owner or the GM to override some character creation rules of a campaign
+func UpdateCampaignRules(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)["campaignKey"]
+
+	rulesMap, ok := decodeArgs("rules", rulesArgs, w, r)
+	if !ok {
+		return
+	}
+
+	campaign, ok := campaigns.load(key, models.ActionManage, w, r)
+	if !ok || !checkIfMatch(campaign, w, r) {
+		return
+	}
+
+	rules := campaign.CharacterRules()
+	err := decodeInto(rulesMap, &rules)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	if invalidArgs := validateRules(rules); invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
+		return
+	}
+
+	campaign.HouseRules = rules
+	campaign.HasHouseRules = true
+
+	err2 := models.Store.Campaigns().Update(ctx, key, &campaign)
+	if err2 != nil {
+		sendUpdateError(err2, w, r)
+		return
+	}
+
+	sendRules(campaign, validatorHeaders(campaign), w)
+}
+
+// DeleteCampaignRules : endpoint for the owner or the GM to drop the house rules of a campaign and go back to the default rules
+func DeleteCampaignRules(w http.ResponseWriter, r *http.Request) {
+	ctx := models.NewContext(r)
+	key := mux.Vars(r)["campaignKey"]
+
+	campaign, ok := campaigns.load(key, models.ActionManage, w, r)
+	if !ok || !checkIfMatch(campaign, w, r) {
+		return
+	}
+
+	campaign.HouseRules = models.Rules{}
+	campaign.HasHouseRules = false
+
+	err := models.Store.Campaigns().Update(ctx, key, &campaign)
+	if err != nil {
+		sendUpdateError(err, w, r)
+		return
+	}
+
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", validatorHeaders(campaign))
+}
+
+// GetCharacterViolations : endpoint to list the character creation rules a character breaks, according to its campaign
+func GetCharacterViolations(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["characterKey"]
+
+	character, ok := characters.load(key, models.ActionRead, w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := models.RulesFor(models.NewContext(r), key, character)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+
+	utils.SendResponse(w, 200, rules.Check(character), "success", nil)
+}
+
+// sendRules : send the character creation rules of a campaign, telling whether they're house rules
+func sendRules(campaign models.Campaign, headers map[string]string, w http.ResponseWriter) {
+	data := make(map[string]interface{})
+
+	err := mapstructure.Decode(campaign.CharacterRules(), &data)
+	if err != nil {
+		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		return
+	}
+	data["HouseRules"] = campaign.HasHouseRules
+
+	utils.SendResponse(w, 200, data, "success", headers)
+}
+
+// validateRules : check what the schema can't, i.e. every skill rating is only given once
+func validateRules(rules models.Rules) fieldErrors {
+	errs := make(fieldErrors)
+
+	rated := make(map[int]bool)
+	for i, slot := range rules.Skills {
+		if rated[slot.Rating] {
+			errs.add(fmt.Sprintf("Skills.%v.Rating", i), "duplicate", "This rating is already listed")
+		}
+		rated[slot.Rating] = true
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// checkRules : the character creation rules a character breaks, according to its campaign
+func checkRules(ctx gocontext.Context, key string, character models.Character) fieldErrors {
+	errs := make(fieldErrors)
+
+	rules, err := models.RulesFor(ctx, key, character)
+	if err != nil {
+		errs.add("CampaignKey", "unavailable", "The rules of this campaign could not be retrieved")
+		return errs
+	}
+
+	for _, violation := range rules.Check(character) {
+		errs.add(violation.Field, violation.Code, violation.Message)
+	}
+
+	return errs
+}
@@ -0,0 +1,44 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dorklord23/anima-prime/models"
+)
+
+// sessions : sessions are started by logging in and only listed or revoked by their user
+var sessions = resource[models.Session]{
+	name:       "sessions",
+	keyParam:   "sessionKey",
+	repository: func() models.Repository[models.Session] { return models.Store.Sessions() },
+	scope: func(r *http.Request) []models.Filter {
+		return []models.Filter{{Field: "UserKey", Value: models.RequesterOf(r).Key}}
+	},
+	// Never give the token hashes away
+	present: func(key string, session models.Session) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"ID":         key,
+			"Device":     session.Device,
+			"CreatedAt":  session.CreatedAt.Format(time.RFC3339),
+			"LastUsedAt": session.LastUsedAt.Format(time.RFC3339),
+		}, nil
+	},
+}
+
+// GetSessions : endpoint to list the devices the current user is logged in from
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	sessions.list(w, r)
+}
+
+// DeleteSessions : endpoint to revoke a session, logging its device out immediately
+// A user could only revoke their own sessions unless they're the admin
+func DeleteSessions(w http.ResponseWriter, r *http.Request) {
+	sessions.delete(w, r)
+}
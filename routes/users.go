@@ -7,19 +7,16 @@
 package routes
 
 import (
+	gocontext "context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/dorklord23/anima-prime/models"
 	"github.com/dorklord23/anima-prime/utils"
-	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/datastore"
 )
 
 // User : struct to hold user data to commit to Datastore
@@ -33,58 +30,80 @@ import (
 	ModifiedAt   time.Time
 } */
 
+// users : users sign up through CreateUsers and could only see or change their own profile
+var users = resource[models.User]{
+	name:       "users",
+	keyParam:   "userKey",
+	repository: func() models.Repository[models.User] { return models.Store.Users() },
+	updateArgs: map[string]string{
+		"FullName": "optional",
+		"Email":    "optional",
+	},
+	validate: func(ctx gocontext.Context, key string, user models.User) fieldErrors {
+		otherKey, _, err := models.Store.Users().FindByEmail(ctx, user.Email)
+		if err == nil && otherKey != key {
+			return fieldErrors{"Email": {Code: "taken", Message: "The email has already been used"}}
+		}
+		return nil
+	},
+	// Never give the password hash away
+	present: func(key string, user models.User) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"ID":        key,
+			"FullName":  user.FullName,
+			"Email":     user.Email,
+			"Authority": user.Authority,
+		}, nil
+	},
+}
+
 // CreateUsers : endpoint to create a new user and obtain access token
 func CreateUsers(w http.ResponseWriter, r *http.Request) {
 	userMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
+	ctx := models.NewContext(r)
 	requiredArgs := map[string]string{
 		"FullName":        "required",
 		"Password":        "required",
 		"PasswordConfirm": "required",
 		"Email":           "required",
+		"Device":          "optional",
 	}
 
 	// Parse the request body and populate user
 	err := json.NewDecoder(r.Body).Decode(&userMap)
 	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
+		data := make(map[string]string)
+		data["Message"] = "The request body must be a JSON object"
+		utils.SendResponse(w, 400, data, "fail", nil)
 		return
 	}
 
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(userMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
+	// Check if there are any missing or invalid arguments
+	invalidArgs := checkPayload(users.name, userMap, requiredArgs)
+	if invalidArgs != nil {
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
 		return
 	}
 
 	// Check if the password and the password confirm is exactly the same
 	if userMap["Password"] != userMap["PasswordConfirm"] {
-		data := make(map[string]string)
-		data["PasswordConfirm"] = "Make sure this field is exactly the same with Password"
-		utils.SendResponse(w, 400, data, "fail", nil)
+		invalidArgs := make(fieldErrors)
+		invalidArgs.add("PasswordConfirm", "mismatch", "Make sure this field is exactly the same with Password")
+		utils.SendResponse(w, 400, invalidArgs, "fail", nil)
 		return
 	}
 
 	// Check if the email has been used already
-	q := datastore.NewQuery("users").Filter("Email =", userMap["Email"])
-	for t := q.Run(ctx); ; {
-		var x models.User
-		_, err := t.Next(&x)
-
-		if err == datastore.Done {
-			// No such email so it's safe to proceed
-			break
-		}
-		if err != nil {
-			utils.SendResponse(w, 500, err.Error(), "error", nil)
-			return
-		}
-
+	_, _, err2 := models.Store.Users().FindByEmail(ctx, fmt.Sprintf("%v", userMap["Email"]))
+	if err2 == nil {
 		// The email has already been used
-		data := make(map[string]string)
-		data["Email"] = "The email has already been used"
-		utils.SendResponse(w, 409, data, "fail", nil)
+		invalidArgs := make(fieldErrors)
+		invalidArgs.add("Email", "taken", "The email has already been used")
+		utils.SendResponse(w, 409, invalidArgs, "fail", nil)
+		return
+	}
+	if err2 != models.ErrNotFound {
+		utils.SendResponse(w, 500, err2.Error(), "error", nil)
 		return
 	}
 
@@ -92,20 +111,14 @@ func CreateUsers(w http.ResponseWriter, r *http.Request) {
 	bytes, _ := bcrypt.GenerateFromPassword([]byte(userMap["Password"].(string)), 14)
 	hash := utils.BytesToString(bytes)
 
-	// Generate refresh token
-	refreshToken := utils.RandSeq(20)
-
 	// Preparing data to save
+	device := deviceName(userMap["Device"], r)
 	userMap["Hash"] = hash
-	userMap["RefreshToken"] = refreshToken
-	userMap["CreatedAt"] = time.Now()
-	userMap["ModifiedAt"] = time.Now()
 	delete(userMap, "Password")
 	delete(userMap, "PasswordConfirm")
+	delete(userMap, "Device")
 
-	if userMap["Authority"] == nil {
-		userMap["Authority"] = "regular"
-	}
+	userMap["Authority"] = "regular"
 
 	var userStruct models.User
 	err3 := mapstructure.Decode(userMap, &userStruct)
@@ -114,18 +127,29 @@ func CreateUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Save to Datastore
-	userKey, err4 := datastore.Put(ctx, datastore.NewIncompleteKey(ctx, "users", nil), &userStruct)
+	// Save to the storage backend
+	userKey, err4 := models.Store.Users().Create(ctx, userStruct)
 	if err4 != nil {
 		utils.SendResponse(w, 500, err4.Error(), "error", nil)
 		return
 	}
 
-	token := utils.GenerateAccessToken(userKey)
+	// Log the new user in on the device they registered from
+	sessionKey, refreshToken, err6 := startSession(ctx, userKey, device)
+	if err6 != nil {
+		utils.SendResponse(w, 500, err6.Error(), "error", nil)
+		return
+	}
+
+	token, err5 := utils.GenerateAccessToken(userKey, sessionKey, userStruct.TokenVersion)
+	if err5 != nil {
+		utils.SendResponse(w, 500, err5.Error(), "error", nil)
+		return
+	}
 
 	data := make(map[string]string)
 	options := make(map[string]string)
-	location := fmt.Sprintf("%v://%v/api/users/%v", r.URL.Scheme, r.Host, userKey.Encode())
+	location := fmt.Sprintf("%v://%v/api/users/%v", r.URL.Scheme, r.Host, userKey)
 	options["Location"] = location
 	data["Token"] = token
 	data["RefreshToken"] = refreshToken
@@ -136,160 +160,59 @@ func CreateUsers(w http.ResponseWriter, r *http.Request) {
 // UpdateUsers : endpoint to update a user data
 // A user could only change their own profile unless they're the admin
 func UpdateUsers(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	userMap := make(map[string]interface{})
-	ctx := appengine.NewContext(r)
-	requiredArgs := map[string]string{
-		"FullName": "optional",
-		"Email":    "optional",
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&userMap)
-	if err != nil {
-		utils.SendResponse(w, 500, err.Error(), "error", nil)
-		return
-	}
-
-	// Check if there are any missing arguments
-	missingArgs := utils.CheckArgs(userMap, requiredArgs)
-	if missingArgs != nil {
-		utils.SendResponse(w, 400, missingArgs, "fail", nil)
-		return
-	}
-
-	// Check if this user is eligible to update the target profile by comparing the email in access token with the email of target profile IF AND ONLY IF the user is a non-admin
-
-	key, err3 := datastore.DecodeKey(params["userKey"])
-	if err3 != nil {
-		data := make(map[string]string)
-		data["Message"] = err3.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-
-	// Because Datastore doesn't differentiate between creating and updating entity,
-	// we need to retrieve the old data first and modify it before commiting it to Datastore
-	var userStruct models.User
-
-	// Retrieve the old data
-	err5 := datastore.Get(ctx, key, &userStruct)
-	if err5 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such user to update"
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
-	if err5 != nil {
-		utils.SendResponse(w, 500, err5.Error(), "error", nil)
-		return
-	}
-
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the emails
-		currentUserEmail := context.Get(r, "currentUserEmail")
-		if userStruct.Email != currentUserEmail {
-			// Different email. Hence, the user is not eligible to update the target profile
-			data := make(map[string]string)
-			data["Message"] = "You are not eligible to update this user"
-			utils.SendResponse(w, 403, data, "fail", nil)
-			return
-		}
-	}
-
-	// Overwrite it with the new one
-	err2 := mapstructure.Decode(userMap, &userStruct)
-	if err2 != nil {
-		utils.SendResponse(w, 500, err2.Error(), "error", nil)
-		return
-	}
-
-	// Commit it to Datastore
-	_, err4 := datastore.Put(ctx, key, &userStruct)
-	if err4 != nil {
-		utils.SendResponse(w, 500, err4.Error(), "error", nil)
-		return
-	}
-
-	data := make(map[string]string)
-	data["Message"] = "OK"
+	users.update(w, r)
+}
 
-	utils.SendResponse(w, 204, data, "success", nil)
+// PatchUsers : endpoint to partially update a user with a JSON Merge Patch or a JSON Patch
+func PatchUsers(w http.ResponseWriter, r *http.Request) {
+	users.patch(w, r)
 }
 
 // GetUsers : endpoint to retrieve a user data
 // A user could only retrieve their own profile unless they're the admin
 func GetUsers(w http.ResponseWriter, r *http.Request) {
+	users.get(w, r)
+}
+
+// RevokeUserTokens : endpoint to revoke every access token and session of a user at once
+// A user could only revoke their own tokens unless they're the admin
+func RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	userMap := make(map[string]interface{})
-	responseTemplate := make(map[string]string)
-	ctx := appengine.NewContext(r)
+	ctx := models.NewContext(r)
+	key := params["userKey"]
 
-	// Check if this user is eligible to retrieve the target profile by comparing the email in access token with the email of target profile IF AND ONLY IF the user is a non-admin
-	key, err := datastore.DecodeKey(params["userKey"])
-	if err != nil {
-		data := make(map[string]string)
-		data["Message"] = err.Error()
-		utils.SendResponse(w, 404, data, "fail", nil)
+	// Check if the requester is allowed to revoke the tokens of this user
+	userStruct, ok := users.load(key, models.ActionUpdate, w, r)
+	if !ok {
 		return
 	}
 
-	var userStruct models.User
+	// Access tokens carrying the old version are rejected by the authentication middleware
+	userStruct.TokenVersion++
 
-	// Retrieve the data
-	err2 := datastore.Get(ctx, key, &userStruct)
-	if err2 == datastore.Done {
-		// No such user
-		data := make(map[string]string)
-		data["Message"] = "There is no such user to retrieve"
-		utils.SendResponse(w, 404, data, "fail", nil)
-		return
-	}
+	err2 := models.Store.Users().Update(ctx, key, &userStruct)
 	if err2 != nil {
-		utils.SendResponse(w, 500, err2.Error(), "error", nil)
+		sendUpdateError(err2, w, r)
 		return
 	}
 
-	// Check the requester's authority first
-	currentUserAuthority := context.Get(r, "currentUserAuthority")
-	if currentUserAuthority != utils.AdminAuthority {
-		// Proceed to compare the emails
-		currentUserEmail := context.Get(r, "currentUserEmail")
-		if userStruct.Email != currentUserEmail {
-			// Different email. Hence, the user is not to retrieve the target profile
-			data := make(map[string]string)
-			data["Message"] = "You are not eligible to retrieve this user data"
-			utils.SendResponse(w, 403, data, "fail", nil)
-			return
-		}
-	}
-
-	err3 := mapstructure.Decode(userStruct, &userMap)
+	// Refresh tokens live in the sessions so drop them too
+	userSessions, err3 := models.Store.Sessions().FindByUser(ctx, key)
 	if err3 != nil {
 		utils.SendResponse(w, 500, err3.Error(), "error", nil)
 		return
 	}
 
-	delete(userMap, "Hash")
-	delete(userMap, "RefreshToken")
-	delete(userMap, "CreatedAt")
-	delete(userMap, "ModifiedAt")
-
-	for key, value := range userMap {
-		strKey := fmt.Sprintf("%v", key)
-		strValue := fmt.Sprintf("%v", value)
-		// var strValue string
-		//
-		// if strKey == "CreatedAt" || strKey == "ModifiedAt" {
-		// 	strValue = fmt.Sprintf("%v", value.(time.Time).Format(time.RFC3339))
-		// } else {
-		// 	strValue = fmt.Sprintf("%v", value)
-		// }
-
-		responseTemplate[strKey] = strValue
+	for _, session := range userSessions {
+		err4 := models.Store.Sessions().Delete(ctx, session.Key)
+		if err4 != nil {
+			utils.SendResponse(w, 500, err4.Error(), "error", nil)
+			return
+		}
 	}
 
-	utils.SendResponse(w, 200, responseTemplate, "success", nil)
+	data := make(map[string]string)
+	data["Message"] = "OK"
+
+	utils.SendResponse(w, 204, data, "success", nil)
 }
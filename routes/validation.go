@@ -0,0 +1,169 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package routes
+
+import (
+	"embed"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// schemaFiles : the JSON Schema of the arguments of every resource, one file per resource named after it
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemas : the compiled schemas, keyed by resource name
+var schemas = compileSchemas()
+
+// messagePrinter : prints the messages of schema violations
+var messagePrinter = message.NewPrinter(language.English)
+
+// Error codes of the arguments checked outside the schemas. They're named after the JSON Schema keyword
+// that would report the same problem
+const (
+	codeRequired   = "required"
+	codeNotAllowed = "additionalProperties"
+	codeType       = "type"
+)
+
+// fieldError : what's wrong with an argument, along with a code clients could act on
+type fieldError struct {
+	Code    string
+	Message string
+}
+
+// fieldErrors : every invalid argument of a request. Nested arguments are named with dots, e.g. "Traits.0.Value"
+type fieldErrors map[string]fieldError
+
+// add : report what's wrong with an argument. Only its first error is kept
+func (errs fieldErrors) add(field string, code string, message string) {
+	if _, ok := errs[field]; !ok {
+		errs[field] = fieldError{Code: code, Message: message}
+	}
+}
+
+// compileSchemas : compile every schema file. A broken schema is a bug so it stops the server from starting
+func compileSchemas() map[string]*jsonschema.Schema {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+
+	compiled := make(map[string]*jsonschema.Schema)
+	for _, entry := range entries {
+		path := "schemas/" + entry.Name()
+
+		file, err := schemaFiles.Open(path)
+		if err != nil {
+			panic(err)
+		}
+
+		doc, err := jsonschema.UnmarshalJSON(file)
+		file.Close()
+		if err != nil {
+			panic(err)
+		}
+
+		if err := compiler.AddResource(path, doc); err != nil {
+			panic(err)
+		}
+
+		compiled[strings.TrimSuffix(entry.Name(), ".json")] = compiler.MustCompile(path)
+	}
+
+	return compiled
+}
+
+// checkPayload : check the arguments of a request against the arguments accepted and the schema of a resource.
+// Returns every invalid argument, or nil when there is none
+func checkPayload(schemaName string, payload map[string]interface{}, args map[string]string) fieldErrors {
+	errs := make(fieldErrors)
+
+	for arg, rule := range args {
+		if _, ok := payload[arg]; !ok && rule == "required" {
+			errs.add(arg, codeRequired, "This argument is missing from the request")
+		}
+	}
+
+	for arg := range payload {
+		if _, ok := args[arg]; !ok {
+			errs.add(arg, codeNotAllowed, "This argument is not accepted")
+		}
+	}
+
+	for field, err := range schemaErrors(schemaName, payload) {
+		errs.add(field, err.Code, err.Message)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// schemaErrors : check arguments against the schema of a resource, without caring which of them are required
+func schemaErrors(schemaName string, payload map[string]interface{}) fieldErrors {
+	errs := make(fieldErrors)
+
+	schema, ok := schemas[schemaName]
+	if !ok {
+		return errs
+	}
+
+	if err, ok := schema.Validate(payload).(*jsonschema.ValidationError); ok {
+		collectErrors(err, errs)
+	}
+
+	return errs
+}
+
+// collectErrors : flatten the tree of schema violations into one error per argument
+func collectErrors(err *jsonschema.ValidationError, errs fieldErrors) {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			collectErrors(cause, errs)
+		}
+		return
+	}
+
+	field := strings.Join(err.InstanceLocation, ".")
+
+	switch k := err.ErrorKind.(type) {
+	case *kind.Required:
+		for _, missing := range k.Missing {
+			errs.add(joinField(field, missing), codeRequired, "This argument is missing from the request")
+		}
+	case *kind.AdditionalProperties:
+		for _, property := range k.Properties {
+			errs.add(joinField(field, property), codeNotAllowed, "This argument is not accepted")
+		}
+	default:
+		code := "invalid"
+		if keywords := k.KeywordPath(); len(keywords) > 0 {
+			code = keywords[0]
+		}
+		errs.add(field, code, k.LocalizedString(messagePrinter))
+	}
+}
+
+// joinField : name a nested argument with dots
+func joinField(parent string, field string) string {
+	if parent == "" {
+		return field
+	}
+
+	return parent + "." + field
+}
@@ -15,3 +15,14 @@ func Contains(a []string, x string) bool {
 	}
 	return false
 }
+
+// Remove : function to return a copy of an array of strings without any occurrence of a value
+func Remove(a []string, x string) []string {
+	result := make([]string, 0, len(a))
+	for _, n := range a {
+		if n != x {
+			result = append(result, n)
+		}
+	}
+	return result
+}
@@ -7,14 +7,8 @@
 package utils
 
 import (
-	"encoding/base64"
 	"encoding/json"
-	"math/rand"
 	"net/http"
-	"strings"
-	"time"
-
-	"google.golang.org/appengine/datastore"
 )
 
 // SendResponse : function to send JSON-formatted HTTP response
@@ -44,23 +38,6 @@ func SendResponse(w http.ResponseWriter, statusCode int, payload interface{}, re
 	w.Write(response)
 }
 
-// GenerateAccessToken : function to generate access token
-func GenerateAccessToken(userKey *datastore.Key) string {
-	var template strings.Builder
-
-	// Generate the access token
-	template.WriteString(userKey.Encode())
-	template.WriteString("|")
-	template.WriteString(time.Now().Format(time.RFC3339))
-	template.WriteString("|")
-	// Expiry time for the token in 1 days
-	template.WriteString("1")
-	template.WriteString("|")
-	template.WriteString(RandSeq(5))
-
-	return base64.StdEncoding.EncodeToString([]byte(template.String()))
-}
-
 // CheckArgs : function to check if an endpoint's arguments are already supplied completely
 func CheckArgs(suppliedArgs map[string]interface{}, requiredArgs map[string]string) map[string]string {
 	var errorList []string
@@ -85,17 +62,3 @@ func CheckArgs(suppliedArgs map[string]interface{}, requiredArgs map[string]stri
 	// Everything is fine
 	return nil
 }
-
-// DieRandomizer : randomizes arbitrary number of dice roll
-func DieRandomizer(dieQty int) []int {
-	result := make([]int, dieQty)
-	rand.Seed(time.Now().UnixNano())
-	min := 1
-	max := 6
-
-	for i := 0; i < dieQty; i++ {
-		result[i] = rand.Intn(max-min) + min
-	}
-
-	return result
-}
@@ -0,0 +1,155 @@
+/* Copyright 2019 Tri Rumekso Anggie Wibowo (trirawibowo [at] gmail [dot] com)
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenIssuer : value of the "iss" claim of every access token
+var TokenIssuer = "anima-prime-api"
+
+// TokenAudience : value of the "aud" claim of every access token
+var TokenAudience = "anima-prime"
+
+// AccessTokenLifetime : how long an access token stays valid after it is issued
+var AccessTokenLifetime = 24 * time.Hour
+
+// ErrInvalidToken : the access token is malformed, has a bad signature or was issued for someone else
+var ErrInvalidToken = errors.New("Invalid access token")
+
+// ErrNoSigningKeys : no access token key is configured
+var ErrNoSigningKeys = errors.New("No access token signing key is configured, set ANIMA_PRIME_TOKEN_KEYS")
+
+// ErrExpiredToken : the access token was valid but is past its expiry time
+var ErrExpiredToken = errors.New("Your token has expired.")
+
+// AccessClaims : claims carried by an access token
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	// SessionKey : the session this token was issued for. Revoking the session revokes the token
+	SessionKey string `json:"sid,omitempty"`
+	// TokenVersion : must match the user's current token version
+	TokenVersion int `json:"ver"`
+}
+
+// SigningKey : HMAC secret used to sign access tokens, identified by the "kid" header
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// signingKeys : the first key signs new tokens, every key is accepted when verifying
+var signingKeys []SigningKey
+
+// LoadSigningKeys : function to configure the access token keys from a "kid:base64secret,kid:base64secret" list.
+// The first key signs new tokens while the others are only kept to verify tokens issued before a rotation.
+// An empty list is refused since instances would otherwise each sign with a key of their own
+func LoadSigningKeys(spec string) error {
+	var keys []SigningKey
+
+	if strings.TrimSpace(spec) == "" {
+		return ErrNoSigningKeys
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("Malformed signing key entry: %q", entry)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return fmt.Errorf("Signing key %v is not valid base64: %v", parts[0], err)
+		}
+		if len(secret) < 32 {
+			return fmt.Errorf("Signing key %v must be at least 32 bytes long", parts[0])
+		}
+
+		keys = append(keys, SigningKey{ID: parts[0], Secret: secret})
+	}
+
+	signingKeys = keys
+	return nil
+}
+
+// GenerateSigningKey : function to sign access tokens with a random key, for local development only.
+// Every token is invalidated on restart and other instances can't verify them
+func GenerateSigningKey() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	signingKeys = []SigningKey{{ID: "ephemeral", Secret: secret}}
+	return nil
+}
+
+// GenerateAccessToken : function to generate a signed access token for a user's session
+func GenerateAccessToken(userKey string, sessionKey string, tokenVersion int) (string, error) {
+	if len(signingKeys) == 0 {
+		return "", errors.New("No access token signing key is configured")
+	}
+
+	now := time.Now()
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{TokenAudience},
+			Subject:   userKey,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenLifetime)),
+			ID:        RandSeq(16),
+		},
+		SessionKey:   sessionKey,
+		TokenVersion: tokenVersion,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = signingKeys[0].ID
+
+	return token.SignedString(signingKeys[0].Secret)
+}
+
+// ParseAccessToken : function to verify an access token and return its claims
+func ParseAccessToken(accessToken string) (*AccessClaims, error) {
+	var claims AccessClaims
+
+	_, err := jwt.ParseWithClaims(accessToken, &claims, lookupSigningKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(TokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrExpiredToken
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func lookupSigningKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	for _, key := range signingKeys {
+		if key.ID == kid {
+			return key.Secret, nil
+		}
+	}
+
+	return nil, ErrInvalidToken
+}